@@ -2,10 +2,16 @@ package config
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/url"
 	"reflect"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -13,6 +19,7 @@ import (
 	"github.com/heetch/confita"
 	"github.com/heetch/confita/backend"
 	"github.com/heetch/confita/backend/env"
+	"github.com/heetch/confita/backend/file"
 	"github.com/heetch/confita/backend/flags"
 )
 
@@ -22,54 +29,233 @@ type Config struct {
 	PIHoleHostname string `config:"pihole_hostname"`
 	PIHolePort     uint16 `config:"pihole_port"`
 	PIHolePassword string `config:"pihole_password"`
+	TopLists       TopListsConfig
+	Inventory      bool
 }
 
+// TopListsConfig holds the number of entries requested for each top list of a
+// Pi-hole instance. A size of 0 disables the list. ClientAds is the number of
+// blocked domains of each client of the SourcesBlocked list, which must be
+// enabled for it.
+type TopListsConfig struct {
+	Queries             uint
+	Ads                 uint
+	Sources             uint
+	SourcesBlocked      uint
+	ClientAds           uint
+	UpstreamsByResponse uint
+}
+
+// EnvConfig is the exporter configuration, loaded from an optional YAML file,
+// the environment variables and the CLI flags, in increasing precedence.
 type EnvConfig struct {
-	PIHoleProtocol      []string      `config:"pihole_protocol"`
-	PIHoleHostname      []string      `config:"pihole_hostname"`
-	PIHolePort          []uint16      `config:"pihole_port"`
-	PIHolePassword      []string      `config:"pihole_password"`
-	BindAddr            string        `config:"bind_addr"`
-	Port                uint16        `config:"port"`
-	Timeout             time.Duration `config:"timeout"`
-	SkipTLSVerification bool          `config:"skip_tls_verification"`
-	Debug               bool          `config:"debug"`
+	PIHoleProtocol         []string      `config:"pihole_protocol" yaml:"pihole_protocol"`
+	PIHoleHostname         []string      `config:"pihole_hostname" yaml:"pihole_hostname"`
+	PIHolePort             []uint16      `config:"pihole_port" yaml:"pihole_port"`
+	PIHolePassword         []string      `config:"pihole_password" yaml:"pihole_password"`
+	TopQueriesCount        []uint        `config:"top_queries_count" yaml:"top_queries_count"`
+	TopAdsCount            []uint        `config:"top_ads_count" yaml:"top_ads_count"`
+	TopSourcesCount        []uint        `config:"top_sources_count" yaml:"top_sources_count"`
+	TopSourcesBlockedCount []uint        `config:"top_sources_blocked_count" yaml:"top_sources_blocked_count"`
+	TopClientAdsCount      []uint        `config:"top_client_ads_count" yaml:"top_client_ads_count"`
+	TopUpstreamsCount      []uint        `config:"top_upstreams_responsetime_count" yaml:"top_upstreams_responsetime_count"`
+	ConfigFile             string        `config:"config_file" yaml:"-"`
+	BindAddr               string        `config:"bind_addr" yaml:"bind_addr"`
+	Port                   uint16        `config:"port" yaml:"port"`
+	WebConfigFile          string        `config:"web_config_file" yaml:"web_config_file"`
+	WebEnableLifecycle     bool          `config:"web_enable_lifecycle" yaml:"web_enable_lifecycle"`
+	InternalMetricsPath    string        `config:"internal_metrics_path" yaml:"internal_metrics_path"`
+	Timeout                time.Duration `config:"timeout" yaml:"timeout"`
+	ScrapeTimeout          time.Duration `config:"scrape_timeout" yaml:"scrape_timeout"`
+	ScrapeTimeoutOffset    time.Duration `config:"scrape_timeout_offset" yaml:"scrape_timeout_offset"`
+	ShutdownGracePeriod    time.Duration `config:"shutdown_grace_period" yaml:"shutdown_grace_period"`
+	SkipTLSVerification    bool          `config:"skip_tls_verification" yaml:"skip_tls_verification"`
+	Inventory              bool          `config:"inventory" yaml:"inventory"`
+	PercentagesAsRatios    bool          `config:"percentages_as_ratios" yaml:"percentages_as_ratios"`
+	ReplyTimeHistograms    bool          `config:"reply_time_histograms" yaml:"reply_time_histograms"`
+	ReplyTimeBuckets       []float64     `config:"reply_time_buckets" yaml:"reply_time_buckets"`
+	ReplyTimeFactor        float64       `config:"reply_time_factor" yaml:"reply_time_factor"`
+	FleetMetrics           bool          `config:"fleet_metrics" yaml:"fleet_metrics"`
+	RecentBlockedCount     uint          `config:"recent_blocked_count" yaml:"recent_blocked_count"`
+	ReadinessMode          string        `config:"readiness_mode" yaml:"readiness_mode"`
+	ReadinessMaxAge        time.Duration `config:"readiness_max_age" yaml:"readiness_max_age"`
+	TracingEndpoint        string        `config:"tracing_endpoint" yaml:"tracing_endpoint"`
+	PushInterval           time.Duration `config:"push_interval" yaml:"push_interval"`
+	InfluxDBURL            string        `config:"influxdb_url" yaml:"influxdb_url"`
+	InfluxDBOrg            string        `config:"influxdb_org" yaml:"influxdb_org"`
+	InfluxDBBucket         string        `config:"influxdb_bucket" yaml:"influxdb_bucket"`
+	InfluxDBToken          string        `config:"influxdb_token" yaml:"influxdb_token"`
+	InfluxDBMeasurement    string        `config:"influxdb_measurement" yaml:"influxdb_measurement"`
+	InfluxDBBatchSize      uint          `config:"influxdb_batch_size" yaml:"influxdb_batch_size"`
+	InfluxDBBufferPath     string        `config:"influxdb_buffer_path" yaml:"influxdb_buffer_path"`
+	OTLPMetricsEndpoint    string        `config:"otlp_metrics_endpoint" yaml:"otlp_metrics_endpoint"`
+	OTLPMetricsProtocol    string        `config:"otlp_metrics_protocol" yaml:"otlp_metrics_protocol"`
+	RemoteWriteURL         string        `config:"remote_write_url" yaml:"remote_write_url"`
+	RemoteWriteToken       string        `config:"remote_write_bearer_token" yaml:"remote_write_bearer_token"`
+	RemoteWriteUsername    string        `config:"remote_write_username" yaml:"remote_write_username"`
+	RemoteWritePassword    string        `config:"remote_write_password" yaml:"remote_write_password"`
+	RemoteWriteWALPath     string        `config:"remote_write_wal_path" yaml:"remote_write_wal_path"`
+	PushgatewayURL         string        `config:"pushgateway_url" yaml:"pushgateway_url"`
+	PushgatewayJob         string        `config:"pushgateway_job" yaml:"pushgateway_job"`
+	MQTTURL                string        `config:"mqtt_url" yaml:"mqtt_url"`
+	MQTTUsername           string        `config:"mqtt_username" yaml:"mqtt_username"`
+	MQTTPassword           string        `config:"mqtt_password" yaml:"mqtt_password"`
+	MQTTClientID           string        `config:"mqtt_client_id" yaml:"mqtt_client_id"`
+	MQTTTopicPrefix        string        `config:"mqtt_topic_prefix" yaml:"mqtt_topic_prefix"`
+	MQTTDiscoveryPrefix    string        `config:"mqtt_discovery_prefix" yaml:"mqtt_discovery_prefix"`
+	MQTTCAFile             string        `config:"mqtt_ca_file" yaml:"mqtt_ca_file"`
+	MQTTCertFile           string        `config:"mqtt_cert_file" yaml:"mqtt_cert_file"`
+	MQTTKeyFile            string        `config:"mqtt_key_file" yaml:"mqtt_key_file"`
+	StatsDAddress          string        `config:"statsd_address" yaml:"statsd_address"`
+	StatsDPrefix           string        `config:"statsd_prefix" yaml:"statsd_prefix"`
+	StatsDTags             []string      `config:"statsd_tags" yaml:"statsd_tags"`
+	StatsDSampleRates      []string      `config:"statsd_sample_rates" yaml:"statsd_sample_rates"`
+	DisableListener        bool          `config:"disable_listener" yaml:"disable_listener"`
+	Once                   bool          `config:"once" yaml:"once"`
+	LogFormat              string        `config:"log_format" yaml:"log_format"`
+	LogLevel               string        `config:"log_level" yaml:"log_level"`
+	Debug                  bool          `config:"debug" yaml:"debug"`
 }
 
 const (
-	DefaultTimeout = 5 * time.Second
+	DefaultTimeout             = 5 * time.Second
+	DefaultScrapeTimeout       = 10 * time.Second
+	DefaultScrapeTimeoutOffset = 500 * time.Millisecond
+	DefaultShutdownGracePeriod = 10 * time.Second
+	DefaultTopSize             = 10
+	DefaultReadinessMaxAge     = 5 * time.Minute
+	DefaultPushInterval        = 30 * time.Second
+	// DefaultInfluxDBMeasurement is the measurement of the Telegraf Prometheus
+	// input, used by the InfluxDB dashboard.
+	DefaultInfluxDBMeasurement = "prometheus"
+	// DefaultInfluxDBBatchSize is the number of lines per write recommended by InfluxDB.
+	DefaultInfluxDBBatchSize = 5000
+	DefaultPushgatewayJob    = "pihole"
+	DefaultMQTTClientID      = "pihole-exporter"
+	DefaultMQTTTopicPrefix   = "pihole-exporter"
+	// DefaultMQTTDiscoveryPrefix is the discovery prefix of Home Assistant.
+	DefaultMQTTDiscoveryPrefix = "homeassistant"
+)
+
+// DefaultReplyTimeBuckets are the buckets of the upstream reply time
+// histograms, in seconds, from a cached upstream to a slow recursive one.
+var DefaultReplyTimeBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// Log formats: text is colored on terminals, logfmt is the same without
+// colors and json is one JSON object per line.
+const (
+	LogFormatText   = "text"
+	LogFormatLogfmt = "logfmt"
+	LogFormatJSON   = "json"
+)
+
+// OTLP protocols of the metrics export.
+const (
+	OTLPProtocolHTTP = "http/protobuf"
+	OTLPProtocolGRPC = "grpc"
+)
+
+// Readiness modes, telling how many Pi-hole targets must have been scraped
+// successfully for the exporter to be ready.
+const (
+	ReadinessModeNone   = "none"
+	ReadinessModeAny    = "any"
+	ReadinessModeQuorum = "quorum"
+	ReadinessModeAll    = "all"
 )
 
 func getDefaultEnvConfig() *EnvConfig {
 	return &EnvConfig{
-		PIHoleProtocol:      []string{"http"},
-		PIHoleHostname:      []string{"127.0.0.1"},
-		PIHolePort:          []uint16{80},
-		PIHolePassword:      []string{},
-		BindAddr:            "0.0.0.0",
-		Port:                9617,
-		Timeout:             DefaultTimeout,
-		SkipTLSVerification: false,
-		Debug:               false,
+		PIHoleProtocol:         []string{"http"},
+		PIHoleHostname:         []string{"127.0.0.1"},
+		PIHolePort:             []uint16{80},
+		PIHolePassword:         []string{},
+		TopQueriesCount:        []uint{DefaultTopSize},
+		TopAdsCount:            []uint{DefaultTopSize},
+		TopSourcesCount:        []uint{DefaultTopSize},
+		TopSourcesBlockedCount: []uint{DefaultTopSize},
+		TopClientAdsCount:      []uint{0},
+		TopUpstreamsCount:      []uint{0},
+		ConfigFile:             "",
+		BindAddr:               "0.0.0.0",
+		Port:                   9617,
+		WebConfigFile:          "",
+		WebEnableLifecycle:     false,
+		InternalMetricsPath:    "",
+		Timeout:                DefaultTimeout,
+		ScrapeTimeout:          DefaultScrapeTimeout,
+		ScrapeTimeoutOffset:    DefaultScrapeTimeoutOffset,
+		ShutdownGracePeriod:    DefaultShutdownGracePeriod,
+		SkipTLSVerification:    false,
+		Inventory:              false,
+		PercentagesAsRatios:    false,
+		ReplyTimeHistograms:    false,
+		ReplyTimeBuckets:       DefaultReplyTimeBuckets,
+		FleetMetrics:           false,
+		RecentBlockedCount:     0,
+		ReadinessMode:          ReadinessModeNone,
+		ReadinessMaxAge:        DefaultReadinessMaxAge,
+		TracingEndpoint:        "",
+		PushInterval:           DefaultPushInterval,
+		InfluxDBURL:            "",
+		InfluxDBOrg:            "",
+		InfluxDBBucket:         "",
+		InfluxDBToken:          "",
+		InfluxDBMeasurement:    DefaultInfluxDBMeasurement,
+		InfluxDBBatchSize:      DefaultInfluxDBBatchSize,
+		InfluxDBBufferPath:     "",
+		OTLPMetricsEndpoint:    "",
+		OTLPMetricsProtocol:    OTLPProtocolHTTP,
+		RemoteWriteURL:         "",
+		RemoteWriteToken:       "",
+		RemoteWriteUsername:    "",
+		RemoteWritePassword:    "",
+		RemoteWriteWALPath:     "",
+		PushgatewayURL:         "",
+		PushgatewayJob:         DefaultPushgatewayJob,
+		MQTTURL:                "",
+		MQTTUsername:           "",
+		MQTTPassword:           "",
+		MQTTClientID:           DefaultMQTTClientID,
+		MQTTTopicPrefix:        DefaultMQTTTopicPrefix,
+		MQTTDiscoveryPrefix:    DefaultMQTTDiscoveryPrefix,
+		MQTTCAFile:             "",
+		MQTTCertFile:           "",
+		MQTTKeyFile:            "",
+		StatsDAddress:          "",
+		StatsDPrefix:           "",
+		StatsDTags:             nil,
+		StatsDSampleRates:      nil,
+		DisableListener:        false,
+		Once:                   false,
+		LogFormat:              LogFormatText,
+		LogLevel:               log.InfoLevel.String(),
+		Debug:                  false,
 	}
 }
 
-// Load method loads the configuration by using both flag or environment variables.
+// Load method loads the configuration by using a configuration file, flag or environment variables.
+// It can be called again to reload the configuration.
 func Load() (*EnvConfig, []Config, error) {
-	loaders := []backend.Backend{
-		env.NewBackend(),
-		flags.NewBackend(),
+	cfg := getDefaultEnvConfig()
+	if err := load(cfg, env.NewBackend(), commandLine); err != nil {
+		return nil, nil, err
 	}
 
-	loader := confita.NewLoader(loaders...)
-
-	cfg := getDefaultEnvConfig()
-	err := loader.Load(context.Background(), cfg)
-	if err != nil {
-		log.Fatalf("error returned when passing config into loader.Load(): %+v", err)
+	// The configuration file path is only known once the environment and
+	// flags are loaded, load again with the file as the lowest precedence.
+	if cfg.ConfigFile != "" {
+		configFile := cfg.ConfigFile
+		cfg = getDefaultEnvConfig()
+		if err := load(cfg, file.NewBackend(configFile), env.NewBackend(), commandLine); err != nil {
+			return nil, nil, err
+		}
+		cfg.ConfigFile = configFile
 	}
 
-	cfg.show()
+	if err := cfg.Validate(); err != nil {
+		return cfg, nil, err
+	}
 
 	if clientsConfig, err := cfg.Split(); err != nil {
 		return cfg, nil, err
@@ -78,6 +264,68 @@ func Load() (*EnvConfig, []Config, error) {
 	}
 }
 
+func load(cfg *EnvConfig, loaders ...backend.Backend) error {
+	loader := confita.NewLoader(loaders...)
+	if err := loader.Load(context.Background(), cfg); err != nil {
+		return fmt.Errorf("error returned when passing config into loader.Load(): %w", err)
+	}
+	return nil
+}
+
+// commandLine loads the command line flags, which are parsed on the first
+// Load and reused on the next ones.
+var commandLine = &flagsBackend{}
+
+// flagsBackend is a flags backend parsing the command line once, as it does
+// not change and the flags can only be defined once on flag.CommandLine. The
+// next loads set the fields of the flags set on the first one.
+type flagsBackend struct {
+	mu sync.Mutex
+	// values holds the values of the flags set by key, nil until the command
+	// line is parsed.
+	values map[string]reflect.Value
+}
+
+// LoadStruct implements confita.StructLoader.
+func (b *flagsBackend) LoadStruct(ctx context.Context, cfg *confita.StructConfig) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.values != nil {
+		for _, field := range cfg.Fields {
+			if value, ok := b.values[field.Key]; ok {
+				field.Value.Set(value)
+			}
+		}
+		return nil
+	}
+
+	if err := flags.NewBackend().LoadStruct(ctx, cfg); err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	flag.CommandLine.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	b.values = map[string]reflect.Value{}
+	for _, field := range cfg.Fields {
+		if set[field.Key] || (field.Short != "" && set[field.Short]) {
+			value := reflect.New(field.Value.Type()).Elem()
+			value.Set(field.Value)
+			b.values[field.Key] = value
+		}
+	}
+	return nil
+}
+
+// Get is not implemented, the fields are loaded by LoadStruct.
+func (b *flagsBackend) Get(context.Context, string) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+// Name returns the name of the flags backend.
+func (b *flagsBackend) Name() string {
+	return "flags"
+}
+
 // String implements fmt.Stringer with a modern strings.Builder implementation.
 func (c *Config) String() string {
 	var b strings.Builder
@@ -107,6 +355,153 @@ func (c Config) Validate() error {
 	return nil
 }
 
+// Validate checks if the settings that are not specific to a host are valid.
+func (c EnvConfig) Validate() error {
+	switch c.ReadinessMode {
+	case ReadinessModeNone, ReadinessModeAny, ReadinessModeQuorum, ReadinessModeAll:
+	default:
+		return fmt.Errorf("invalid readiness mode %s: must be none, any, quorum or all", c.ReadinessMode)
+	}
+	if c.ReadinessMaxAge <= 0 {
+		return fmt.Errorf("invalid readiness max age %s: must be positive", c.ReadinessMaxAge)
+	}
+	switch c.LogFormat {
+	case LogFormatText, LogFormatLogfmt, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid log format %s: must be text, logfmt or json", c.LogFormat)
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log level %s: %w", c.LogLevel, err)
+	}
+	if c.InternalMetricsPath != "" && (!strings.HasPrefix(c.InternalMetricsPath, "/") || c.InternalMetricsPath == "/" || c.InternalMetricsPath == "/metrics") {
+		return fmt.Errorf("invalid internal metrics path %s: must start with / and differ from / and /metrics", c.InternalMetricsPath)
+	}
+	if c.ScrapeTimeout <= 0 {
+		return fmt.Errorf("invalid scrape timeout %s: must be positive", c.ScrapeTimeout)
+	}
+	if c.ScrapeTimeoutOffset < 0 {
+		return fmt.Errorf("invalid scrape timeout offset %s: must not be negative", c.ScrapeTimeoutOffset)
+	}
+	if c.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("invalid shutdown grace period %s: must not be negative", c.ShutdownGracePeriod)
+	}
+	if c.PushInterval <= 0 {
+		return fmt.Errorf("invalid push interval %s: must be positive", c.PushInterval)
+	}
+	if c.InfluxDBURL != "" {
+		if u, err := url.Parse(c.InfluxDBURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid InfluxDB URL %s: must be an http or https URL", c.InfluxDBURL)
+		}
+		if c.InfluxDBOrg == "" || c.InfluxDBBucket == "" {
+			return fmt.Errorf("the InfluxDB organization and bucket are required to push to %s", c.InfluxDBURL)
+		}
+		if c.InfluxDBMeasurement == "" {
+			return fmt.Errorf("invalid InfluxDB measurement: must not be empty")
+		}
+		if c.InfluxDBBatchSize == 0 {
+			return fmt.Errorf("invalid InfluxDB batch size %d: must be positive", c.InfluxDBBatchSize)
+		}
+	}
+	switch c.OTLPMetricsProtocol {
+	case OTLPProtocolHTTP, OTLPProtocolGRPC:
+	default:
+		return fmt.Errorf("invalid OTLP metrics protocol %s: must be http/protobuf or grpc", c.OTLPMetricsProtocol)
+	}
+	if c.OTLPMetricsEndpoint != "" {
+		if u, err := url.Parse(c.OTLPMetricsEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid OTLP metrics endpoint %s: must be an http or https URL", c.OTLPMetricsEndpoint)
+		}
+	}
+	if c.RemoteWriteURL != "" {
+		if u, err := url.Parse(c.RemoteWriteURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid remote write URL %s: must be an http or https URL", c.RemoteWriteURL)
+		}
+	}
+	if c.RemoteWriteToken != "" && c.RemoteWriteUsername != "" {
+		return fmt.Errorf("the remote write bearer token and basic authentication are mutually exclusive")
+	}
+	if c.PushgatewayURL != "" {
+		if u, err := url.Parse(c.PushgatewayURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid Pushgateway URL %s: must be an http or https URL", c.PushgatewayURL)
+		}
+		if c.PushgatewayJob == "" {
+			return fmt.Errorf("invalid Pushgateway job: must not be empty")
+		}
+	}
+	if c.MQTTURL != "" {
+		if u, err := url.Parse(c.MQTTURL); err != nil || !slices.Contains([]string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}, u.Scheme) || u.Host == "" {
+			return fmt.Errorf("invalid MQTT URL %s: must be a tcp, mqtt, ssl, tls, mqtts, ws or wss URL", c.MQTTURL)
+		}
+		if c.MQTTClientID == "" {
+			return fmt.Errorf("invalid MQTT client ID: must not be empty")
+		}
+		if c.MQTTTopicPrefix == "" || strings.ContainsAny(c.MQTTTopicPrefix, "+#") || strings.ContainsAny(c.MQTTDiscoveryPrefix, "+#") {
+			return fmt.Errorf("invalid MQTT topic prefixes %s and %s: must not contain wildcards, nor be empty for the topic one", c.MQTTTopicPrefix, c.MQTTDiscoveryPrefix)
+		}
+		if (c.MQTTCertFile == "") != (c.MQTTKeyFile == "") {
+			return fmt.Errorf("the MQTT client certificate and key files must be set together")
+		}
+	}
+	if _, err := c.StatsDSampleRateMap(); err != nil {
+		return err
+	}
+	for i := range c.PIHoleHostname {
+		_, sourcesBlocked, _ := extractUintConfig(c.TopSourcesBlockedCount, i, len(c.PIHoleHostname))
+		_, clientAds, _ := extractUintConfig(c.TopClientAdsCount, i, len(c.PIHoleHostname))
+		if clientAds > 0 && sourcesBlocked == 0 {
+			return fmt.Errorf("invalid top client ads count %d: requires a positive top sources blocked count", clientAds)
+		}
+	}
+	for i, bucket := range c.ReplyTimeBuckets {
+		if bucket <= 0 || (i > 0 && bucket <= c.ReplyTimeBuckets[i-1]) {
+			return fmt.Errorf("invalid reply time buckets %v: must be positive and increasing", c.ReplyTimeBuckets)
+		}
+	}
+	if c.ReplyTimeFactor != 0 && c.ReplyTimeFactor <= 1 {
+		return fmt.Errorf("invalid reply time factor %v: must be greater than 1, or 0 for classic histograms only", c.ReplyTimeFactor)
+	}
+	if c.DisableListener && !c.Pushes() {
+		return fmt.Errorf("the listener can only be disabled when pushing the metrics to InfluxDB, OTLP, remote write, a Pushgateway, MQTT or DogStatsD")
+	}
+	if c.Once && !c.Pushes() {
+		return fmt.Errorf("the once mode requires pushing the metrics to InfluxDB, OTLP, remote write, a Pushgateway, MQTT or DogStatsD")
+	}
+	return nil
+}
+
+// CheckReload checks that the settings only applied at startup are the same in
+// the reloaded configuration c as in the startup one.
+func (c EnvConfig) CheckReload(startup *EnvConfig) error {
+	if c.PercentagesAsRatios != startup.PercentagesAsRatios ||
+		c.ReplyTimeHistograms != startup.ReplyTimeHistograms ||
+		!slices.Equal(c.ReplyTimeBuckets, startup.ReplyTimeBuckets) ||
+		c.ReplyTimeFactor != startup.ReplyTimeFactor ||
+		c.FleetMetrics != startup.FleetMetrics {
+		return fmt.Errorf("percentages_as_ratios, reply_time_histograms, reply_time_buckets, reply_time_factor and fleet_metrics can only be changed by a restart")
+	}
+	return nil
+}
+
+// Pushes tells whether the metrics are pushed to a sink.
+func (c EnvConfig) Pushes() bool {
+	return c.InfluxDBURL != "" || c.OTLPMetricsEndpoint != "" || c.RemoteWriteURL != "" || c.PushgatewayURL != "" || c.MQTTURL != "" || c.StatsDAddress != ""
+}
+
+// StatsDSampleRateMap returns the DogStatsD sample rates by metric name, from
+// the metric=rate entries of StatsDSampleRates.
+func (c EnvConfig) StatsDSampleRateMap() (map[string]float64, error) {
+	rates := make(map[string]float64, len(c.StatsDSampleRates))
+	for _, entry := range c.StatsDSampleRates {
+		name, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		rate, err := strconv.ParseFloat(value, 64)
+		if !found || name == "" || err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid DogStatsD sample rate %s: must be metric=rate with a rate in ]0, 1]", entry)
+		}
+		rates[name] = rate
+	}
+	return rates, nil
+}
+
 func (c EnvConfig) Split() ([]Config, error) {
 	hostsCount := len(c.PIHoleHostname)
 	result := make([]Config, 0, hostsCount)
@@ -114,6 +509,7 @@ func (c EnvConfig) Split() ([]Config, error) {
 	for i, hostname := range c.PIHoleHostname {
 		config := Config{
 			PIHoleHostname: strings.TrimSpace(hostname),
+			Inventory:      c.Inventory,
 		}
 
 		if len(c.PIHolePort) == 1 {
@@ -136,6 +532,30 @@ func (c EnvConfig) Split() ([]Config, error) {
 			return nil, fmt.Errorf("wrong number of PIHolePassword: must be empty, single value or one per host")
 		}
 
+		topLists := []struct {
+			name   string
+			data   []uint
+			target *uint
+		}{
+			{"TopQueriesCount", c.TopQueriesCount, &config.TopLists.Queries},
+			{"TopAdsCount", c.TopAdsCount, &config.TopLists.Ads},
+			{"TopSourcesCount", c.TopSourcesCount, &config.TopLists.Sources},
+			{"TopSourcesBlockedCount", c.TopSourcesBlockedCount, &config.TopLists.SourcesBlocked},
+			{"TopClientAdsCount", c.TopClientAdsCount, &config.TopLists.ClientAds},
+			{"TopUpstreamsCount", c.TopUpstreamsCount, &config.TopLists.UpstreamsByResponse},
+		}
+		for _, topList := range topLists {
+			if hasData, data, isValid := extractUintConfig(topList.data, i, hostsCount); hasData {
+				*topList.target = data
+			} else if !isValid {
+				return nil, fmt.Errorf("wrong number of %s: must be empty, single value or one per host", topList.name)
+			}
+		}
+
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration for host %s: %w", config.PIHoleHostname, err)
+		}
+
 		result = append(result, config)
 	}
 
@@ -161,7 +581,22 @@ func extractStringConfig(data []string, idx int, hostsCount int) (bool, string,
 	return false, "", true
 }
 
-func (c EnvConfig) show() {
+func extractUintConfig(data []uint, idx int, hostsCount int) (bool, uint, bool) {
+	if len(data) == 1 {
+		return true, data[0], true
+	} else if len(data) == hostsCount {
+		return true, data[idx], true
+	} else if len(data) != 0 { //Host count missmatch
+		return false, 0, false
+	}
+
+	// Empty
+	return false, 0, true
+}
+
+// Show logs the configuration at debug level, the secrets being masked. It is
+// called once the logging is configured from it.
+func (c EnvConfig) Show() {
 	val := reflect.ValueOf(&c).Elem()
 	log.Debug("------------------------------------")
 	log.Debug("-  Pi-hole exporter configuration  -")
@@ -173,10 +608,15 @@ func (c EnvConfig) show() {
 		typeField := val.Type().Field(i)
 
 		// Do not print password but keep authentication method visibility
-		if typeField.Name != "PIHolePassword" {
-			log.Debugf("%s : %v", typeField.Name, valueField.Interface())
-		} else {
+		switch typeField.Name {
+		case "PIHolePassword":
 			showAuthenticationMethod(typeField.Name, valueField.Len())
+		case "InfluxDBToken", "RemoteWriteToken", "RemoteWritePassword", "MQTTPassword":
+			if valueField.Len() > 0 {
+				log.Debugf("%s : *****", typeField.Name)
+			}
+		default:
+			log.Debugf("%s : %v", typeField.Name, valueField.Interface())
 		}
 	}
 	log.Debug("------------------------------------")
@@ -1,14 +1,17 @@
 package config
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSplitDefault(t *testing.T) {
@@ -26,6 +29,200 @@ func TestSplitDefault(t *testing.T) {
 	assert.Empty(clientConfig.PIHolePassword)
 }
 
+var defaultTopLists = TopListsConfig{
+	Queries:        DefaultTopSize,
+	Ads:            DefaultTopSize,
+	Sources:        DefaultTopSize,
+	SourcesBlocked: DefaultTopSize,
+}
+
+func TestSplitTopLists(t *testing.T) {
+	assert := assert.New(t)
+
+	env := getDefaultEnvConfig()
+	env.PIHoleHostname = []string{"127.0.0.1", "127.0.0.2"}
+	env.TopQueriesCount = []uint{25}
+	env.TopAdsCount = []uint{0, 5}
+	env.TopClientAdsCount = []uint{3}
+	env.TopUpstreamsCount = []uint{}
+
+	clientConfigs, err := env.Split()
+	assert.NoError(err)
+	assert.Len(clientConfigs, 2)
+
+	assert.Equal(TopListsConfig{
+		Queries:        25,
+		Ads:            0,
+		Sources:        DefaultTopSize,
+		SourcesBlocked: DefaultTopSize,
+		ClientAds:      3,
+	}, clientConfigs[0].TopLists)
+	assert.Equal(TopListsConfig{
+		Queries:        25,
+		Ads:            5,
+		Sources:        DefaultTopSize,
+		SourcesBlocked: DefaultTopSize,
+		ClientAds:      3,
+	}, clientConfigs[1].TopLists)
+
+	env.TopSourcesCount = []uint{1, 2, 3}
+	_, err = env.Split()
+	assert.Error(err)
+}
+
+func TestValidateEnvConfig(t *testing.T) {
+	env := getDefaultEnvConfig()
+	assert.NoError(t, env.Validate())
+
+	env.ReadinessMode = "most"
+	assert.Error(t, env.Validate())
+
+	env.ReadinessMode = ReadinessModeAll
+	env.ReadinessMaxAge = 0
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.ShutdownGracePeriod = -time.Second
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.PIHoleHostname = []string{"10.0.0.1", "10.0.0.2"}
+	env.TopSourcesBlockedCount = []uint{5, 0}
+	env.TopClientAdsCount = []uint{3}
+	assert.Error(t, env.Validate())
+	env.TopClientAdsCount = []uint{3, 0}
+	assert.NoError(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.LogFormat = "xml"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.LogLevel = "verbose"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.InternalMetricsPath = "/metrics"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.InternalMetricsPath = "internal_metrics"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.InternalMetricsPath = "/internal_metrics"
+	assert.NoError(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.PushInterval = 0
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.InfluxDBURL = "influxdb:8086"
+	env.InfluxDBOrg, env.InfluxDBBucket = "home", "pihole"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.InfluxDBURL = "http://influxdb:8086"
+	assert.Error(t, env.Validate(), "the organization and bucket are required")
+
+	env.InfluxDBOrg, env.InfluxDBBucket = "home", "pihole"
+	assert.NoError(t, env.Validate())
+
+	env.InfluxDBBatchSize = 0
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.OTLPMetricsProtocol = "http/json"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.OTLPMetricsEndpoint = "otel-collector:4317"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.DisableListener = true
+	assert.Error(t, env.Validate(), "the metrics must be pushed without listener")
+
+	env.RemoteWriteURL = "http://prometheus:9090/api/v1/write"
+	assert.NoError(t, env.Validate())
+
+	env.RemoteWriteToken, env.RemoteWriteUsername = "token", "branch"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.RemoteWriteURL = "prometheus:9090"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.Once = true
+	assert.Error(t, env.Validate(), "the metrics must be pushed in once mode")
+
+	env.PushgatewayURL = "http://pushgateway:9091"
+	assert.NoError(t, env.Validate())
+
+	env.PushgatewayJob = ""
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.PushgatewayURL = "pushgateway:9091"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.MQTTURL = "mqtts://broker:8883"
+	assert.NoError(t, env.Validate())
+
+	env.MQTTTopicPrefix = "pihole/#"
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.MQTTURL = "mqtts://broker:8883"
+	env.MQTTCertFile = "/etc/mqtt/cert.pem"
+	assert.Error(t, env.Validate(), "the client key is required with the certificate")
+
+	env = getDefaultEnvConfig()
+	env.MQTTURL = "http://broker:1883"
+	assert.Error(t, env.Validate())
+
+	startup := getDefaultEnvConfig()
+	env = getDefaultEnvConfig()
+	env.Port = 9618
+	assert.NoError(t, env.CheckReload(startup))
+
+	env.ReplyTimeHistograms = true
+	assert.Error(t, env.CheckReload(startup), "the reply time histograms are registered at startup")
+
+	env = getDefaultEnvConfig()
+	env.ReplyTimeBuckets = []float64{0.1, 0.01}
+	assert.Error(t, env.Validate(), "the buckets must be increasing")
+
+	env = getDefaultEnvConfig()
+	env.ReplyTimeFactor = 1.1
+	assert.NoError(t, env.Validate())
+
+	env.ReplyTimeFactor = 0.5
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.StatsDSampleRates = []string{"pihole_top_queries=0.1", "pihole_top_ads=1"}
+	rates, err := env.StatsDSampleRateMap()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"pihole_top_queries": 0.1, "pihole_top_ads": 1}, rates)
+
+	for _, rate := range []string{"pihole_top_queries", "pihole_top_queries=0", "pihole_top_queries=2", "=0.5"} {
+		env.StatsDSampleRates = []string{rate}
+		assert.Error(t, env.Validate(), rate)
+	}
+
+	env = getDefaultEnvConfig()
+	env.ScrapeTimeout = 0
+	assert.Error(t, env.Validate())
+
+	env = getDefaultEnvConfig()
+	env.ScrapeTimeoutOffset = -time.Second
+	assert.Error(t, env.Validate())
+}
+
 func TestSplitMultipleHostWithSameConfig(t *testing.T) {
 	assert := assert.New(t)
 
@@ -134,6 +331,9 @@ func withArgs(args []string, f func()) {
 	originalArgs := os.Args
 	defer func() { os.Args = originalArgs }()
 	os.Args = args
+	// Each call stands for a new process, which parses its command line.
+	flag.CommandLine = flag.NewFlagSet(args[0], flag.ExitOnError)
+	commandLine = &flagsBackend{}
 	f()
 }
 
@@ -171,19 +371,41 @@ func TestZLoadConfigWithFlags(t *testing.T) {
 		},
 		envVars: map[string]string{},
 		expectedEnvConfig: &EnvConfig{
-			PIHoleProtocol:      []string{"https"},
-			PIHoleHostname:      []string{"my.pi.hole"},
-			PIHolePort:          []uint16{443},
-			PIHolePassword:      []string{"secret"},
-			BindAddr:            "127.0.0.1",
-			Port:                9000,
-			Timeout:             10 * time.Second,
-			SkipTLSVerification: true,
-			Debug:               true,
+			PIHoleProtocol:         []string{"https"},
+			PIHoleHostname:         []string{"my.pi.hole"},
+			PIHolePort:             []uint16{443},
+			PIHolePassword:         []string{"secret"},
+			TopQueriesCount:        []uint{DefaultTopSize},
+			TopAdsCount:            []uint{DefaultTopSize},
+			TopSourcesCount:        []uint{DefaultTopSize},
+			TopSourcesBlockedCount: []uint{DefaultTopSize},
+			TopClientAdsCount:      []uint{0},
+			TopUpstreamsCount:      []uint{0},
+			BindAddr:               "127.0.0.1",
+			Port:                   9000,
+			Timeout:                10 * time.Second,
+			ScrapeTimeout:          DefaultScrapeTimeout,
+			ScrapeTimeoutOffset:    DefaultScrapeTimeoutOffset,
+			ShutdownGracePeriod:    DefaultShutdownGracePeriod,
+			SkipTLSVerification:    true,
+			ReadinessMode:          ReadinessModeNone,
+			ReadinessMaxAge:        DefaultReadinessMaxAge,
+			ReplyTimeBuckets:       DefaultReplyTimeBuckets,
+			PushInterval:           DefaultPushInterval,
+			InfluxDBMeasurement:    DefaultInfluxDBMeasurement,
+			InfluxDBBatchSize:      DefaultInfluxDBBatchSize,
+			OTLPMetricsProtocol:    OTLPProtocolHTTP,
+			PushgatewayJob:         DefaultPushgatewayJob,
+			MQTTClientID:           DefaultMQTTClientID,
+			MQTTTopicPrefix:        DefaultMQTTTopicPrefix,
+			MQTTDiscoveryPrefix:    DefaultMQTTDiscoveryPrefix,
+			LogFormat:              LogFormatText,
+			LogLevel:               "info",
+			Debug:                  true,
 		},
 		expectedNumClient: 1,
 		expectedClients: []Config{
-			{PIHoleProtocol: "https", PIHoleHostname: "my.pi.hole", PIHolePort: 443, PIHolePassword: "secret"},
+			{PIHoleProtocol: "https", PIHoleHostname: "my.pi.hole", PIHolePort: 443, PIHolePassword: "secret", TopLists: defaultTopLists},
 		},
 	}
 
@@ -237,25 +459,133 @@ func TestLoadConfigEnvVars(t *testing.T) {
 	t.Setenv("PIHOLE_HOSTNAME", "env.pi.hole")
 	t.Setenv("PIHOLE_PORT", "8443")
 	t.Setenv("PIHOLE_PASSWORD", "env_secret")
+	t.Setenv("TOP_QUERIES_COUNT", "20")
+	t.Setenv("TOP_ADS_COUNT", "20")
+	t.Setenv("TOP_SOURCES_COUNT", "5")
+	t.Setenv("TOP_SOURCES_BLOCKED_COUNT", "5")
+	t.Setenv("TOP_CLIENT_ADS_COUNT", "3")
+	t.Setenv("TOP_UPSTREAMS_RESPONSETIME_COUNT", "0")
 	t.Setenv("BIND_ADDR", "0.0.0.0")
 	t.Setenv("PORT", "9001")
+	t.Setenv("WEB_CONFIG_FILE", "/etc/pihole-exporter/web.yml")
+	t.Setenv("INTERNAL_METRICS_PATH", "/internal_metrics")
 	t.Setenv("TIMEOUT", "15s")
+	t.Setenv("SCRAPE_TIMEOUT", "20s")
+	t.Setenv("SCRAPE_TIMEOUT_OFFSET", "1s")
+	t.Setenv("SHUTDOWN_GRACE_PERIOD", "30s")
 	t.Setenv("SKIP_TLS_VERIFICATION", "true")
+	t.Setenv("INVENTORY", "true")
+	t.Setenv("PERCENTAGES_AS_RATIOS", "true")
+	t.Setenv("REPLY_TIME_HISTOGRAMS", "true")
+	t.Setenv("REPLY_TIME_BUCKETS", "0.01,0.1,1")
+	t.Setenv("REPLY_TIME_FACTOR", "1.1")
+	t.Setenv("FLEET_METRICS", "true")
+	t.Setenv("RECENT_BLOCKED_COUNT", "50")
+	t.Setenv("READINESS_MODE", "quorum")
+	t.Setenv("READINESS_MAX_AGE", "3m")
+	t.Setenv("TRACING_ENDPOINT", "http://otel-collector:4318/v1/traces")
+	t.Setenv("PUSH_INTERVAL", "1m")
+	t.Setenv("INFLUXDB_URL", "http://influxdb:8086")
+	t.Setenv("INFLUXDB_ORG", "home")
+	t.Setenv("INFLUXDB_BUCKET", "pihole")
+	t.Setenv("INFLUXDB_TOKEN", "token")
+	t.Setenv("INFLUXDB_MEASUREMENT", "pihole")
+	t.Setenv("INFLUXDB_BATCH_SIZE", "1000")
+	t.Setenv("INFLUXDB_BUFFER_PATH", "/var/lib/pihole-exporter/influxdb")
+	t.Setenv("OTLP_METRICS_ENDPOINT", "http://otel-collector:4317")
+	t.Setenv("OTLP_METRICS_PROTOCOL", "grpc")
+	t.Setenv("REMOTE_WRITE_URL", "https://prometheus.example.com/api/v1/write")
+	t.Setenv("REMOTE_WRITE_USERNAME", "branch")
+	t.Setenv("REMOTE_WRITE_PASSWORD", "secret")
+	t.Setenv("REMOTE_WRITE_WAL_PATH", "/var/lib/pihole-exporter/wal")
+	t.Setenv("PUSHGATEWAY_URL", "http://pushgateway:9091")
+	t.Setenv("PUSHGATEWAY_JOB", "pihole-cron")
+	t.Setenv("MQTT_URL", "ssl://broker:8883")
+	t.Setenv("MQTT_USERNAME", "exporter")
+	t.Setenv("MQTT_PASSWORD", "secret")
+	t.Setenv("MQTT_CLIENT_ID", "pihole-exporter-1")
+	t.Setenv("MQTT_TOPIC_PREFIX", "home/pihole")
+	t.Setenv("MQTT_DISCOVERY_PREFIX", "ha")
+	t.Setenv("MQTT_CA_FILE", "/etc/mqtt/ca.pem")
+	t.Setenv("MQTT_CERT_FILE", "/etc/mqtt/cert.pem")
+	t.Setenv("MQTT_KEY_FILE", "/etc/mqtt/key.pem")
+	t.Setenv("STATSD_ADDRESS", "unix:///var/run/datadog/dsd.socket")
+	t.Setenv("STATSD_PREFIX", "home.")
+	t.Setenv("STATSD_TAGS", "env:lab,site:home")
+	t.Setenv("STATSD_SAMPLE_RATES", "pihole_top_queries=0.1")
+	t.Setenv("DISABLE_LISTENER", "true")
+	t.Setenv("ONCE", "true")
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOG_LEVEL", "warning")
 	t.Setenv("DEBUG", "true")
 
 	expectedEnvConfig := &EnvConfig{
-		PIHoleProtocol:      []string{"https"},
-		PIHoleHostname:      []string{"env.pi.hole"},
-		PIHolePort:          []uint16{8443},
-		PIHolePassword:      []string{"env_secret"},
-		BindAddr:            "0.0.0.0",
-		Port:                9001,
-		Timeout:             15 * time.Second,
-		SkipTLSVerification: true,
-		Debug:               true,
+		PIHoleProtocol:         []string{"https"},
+		PIHoleHostname:         []string{"env.pi.hole"},
+		PIHolePort:             []uint16{8443},
+		PIHolePassword:         []string{"env_secret"},
+		TopQueriesCount:        []uint{20},
+		TopAdsCount:            []uint{20},
+		TopSourcesCount:        []uint{5},
+		TopSourcesBlockedCount: []uint{5},
+		TopClientAdsCount:      []uint{3},
+		TopUpstreamsCount:      []uint{0},
+		BindAddr:               "0.0.0.0",
+		Port:                   9001,
+		WebConfigFile:          "/etc/pihole-exporter/web.yml",
+		InternalMetricsPath:    "/internal_metrics",
+		Timeout:                15 * time.Second,
+		ScrapeTimeout:          20 * time.Second,
+		ScrapeTimeoutOffset:    time.Second,
+		ShutdownGracePeriod:    30 * time.Second,
+		SkipTLSVerification:    true,
+		Inventory:              true,
+		PercentagesAsRatios:    true,
+		ReplyTimeHistograms:    true,
+		ReplyTimeBuckets:       []float64{0.01, 0.1, 1},
+		ReplyTimeFactor:        1.1,
+		FleetMetrics:           true,
+		RecentBlockedCount:     50,
+		ReadinessMode:          ReadinessModeQuorum,
+		ReadinessMaxAge:        3 * time.Minute,
+		TracingEndpoint:        "http://otel-collector:4318/v1/traces",
+		PushInterval:           time.Minute,
+		InfluxDBURL:            "http://influxdb:8086",
+		InfluxDBOrg:            "home",
+		InfluxDBBucket:         "pihole",
+		InfluxDBToken:          "token",
+		InfluxDBMeasurement:    "pihole",
+		InfluxDBBatchSize:      1000,
+		InfluxDBBufferPath:     "/var/lib/pihole-exporter/influxdb",
+		OTLPMetricsEndpoint:    "http://otel-collector:4317",
+		OTLPMetricsProtocol:    OTLPProtocolGRPC,
+		RemoteWriteURL:         "https://prometheus.example.com/api/v1/write",
+		RemoteWriteUsername:    "branch",
+		RemoteWritePassword:    "secret",
+		RemoteWriteWALPath:     "/var/lib/pihole-exporter/wal",
+		PushgatewayURL:         "http://pushgateway:9091",
+		PushgatewayJob:         "pihole-cron",
+		MQTTURL:                "ssl://broker:8883",
+		MQTTUsername:           "exporter",
+		MQTTPassword:           "secret",
+		MQTTClientID:           "pihole-exporter-1",
+		MQTTTopicPrefix:        "home/pihole",
+		MQTTDiscoveryPrefix:    "ha",
+		MQTTCAFile:             "/etc/mqtt/ca.pem",
+		MQTTCertFile:           "/etc/mqtt/cert.pem",
+		MQTTKeyFile:            "/etc/mqtt/key.pem",
+		StatsDAddress:          "unix:///var/run/datadog/dsd.socket",
+		StatsDPrefix:           "home.",
+		StatsDTags:             []string{"env:lab", "site:home"},
+		StatsDSampleRates:      []string{"pihole_top_queries=0.1"},
+		DisableListener:        true,
+		Once:                   true,
+		LogFormat:              LogFormatJSON,
+		LogLevel:               "warning",
+		Debug:                  true,
 	}
 	expectedClients := []Config{
-		{PIHoleProtocol: "https", PIHoleHostname: "env.pi.hole", PIHolePort: 8443, PIHolePassword: "env_secret"},
+		{PIHoleProtocol: "https", PIHoleHostname: "env.pi.hole", PIHolePort: 8443, PIHolePassword: "env_secret", TopLists: TopListsConfig{Queries: 20, Ads: 20, Sources: 5, SourcesBlocked: 5, ClientAds: 3}, Inventory: true},
 	}
 
 	withArgs([]string{"pihole-exporter"}, func() {
@@ -291,9 +621,64 @@ func TestLoadConfigDefaults(t *testing.T) {
 		os.Unsetenv("PIHOLE_PASSWORD")
 		os.Unsetenv("BIND_ADDR")
 		os.Unsetenv("PORT")
+		os.Unsetenv("WEB_CONFIG_FILE")
+		os.Unsetenv("INTERNAL_METRICS_PATH")
 		os.Unsetenv("TIMEOUT")
+		os.Unsetenv("SCRAPE_TIMEOUT")
+		os.Unsetenv("SCRAPE_TIMEOUT_OFFSET")
+		os.Unsetenv("SHUTDOWN_GRACE_PERIOD")
 		os.Unsetenv("SKIP_TLS_VERIFICATION")
+		os.Unsetenv("INVENTORY")
+		os.Unsetenv("PERCENTAGES_AS_RATIOS")
+		os.Unsetenv("REPLY_TIME_HISTOGRAMS")
+		os.Unsetenv("REPLY_TIME_BUCKETS")
+		os.Unsetenv("REPLY_TIME_FACTOR")
+		os.Unsetenv("FLEET_METRICS")
+		os.Unsetenv("RECENT_BLOCKED_COUNT")
+		os.Unsetenv("READINESS_MODE")
+		os.Unsetenv("READINESS_MAX_AGE")
+		os.Unsetenv("TRACING_ENDPOINT")
+		os.Unsetenv("PUSH_INTERVAL")
+		os.Unsetenv("INFLUXDB_URL")
+		os.Unsetenv("INFLUXDB_ORG")
+		os.Unsetenv("INFLUXDB_BUCKET")
+		os.Unsetenv("INFLUXDB_TOKEN")
+		os.Unsetenv("INFLUXDB_MEASUREMENT")
+		os.Unsetenv("INFLUXDB_BATCH_SIZE")
+		os.Unsetenv("INFLUXDB_BUFFER_PATH")
+		os.Unsetenv("OTLP_METRICS_ENDPOINT")
+		os.Unsetenv("OTLP_METRICS_PROTOCOL")
+		os.Unsetenv("REMOTE_WRITE_URL")
+		os.Unsetenv("REMOTE_WRITE_BEARER_TOKEN")
+		os.Unsetenv("REMOTE_WRITE_USERNAME")
+		os.Unsetenv("REMOTE_WRITE_PASSWORD")
+		os.Unsetenv("REMOTE_WRITE_WAL_PATH")
+		os.Unsetenv("PUSHGATEWAY_URL")
+		os.Unsetenv("PUSHGATEWAY_JOB")
+		os.Unsetenv("MQTT_URL")
+		os.Unsetenv("MQTT_USERNAME")
+		os.Unsetenv("MQTT_PASSWORD")
+		os.Unsetenv("MQTT_CLIENT_ID")
+		os.Unsetenv("MQTT_TOPIC_PREFIX")
+		os.Unsetenv("MQTT_DISCOVERY_PREFIX")
+		os.Unsetenv("MQTT_CA_FILE")
+		os.Unsetenv("MQTT_CERT_FILE")
+		os.Unsetenv("MQTT_KEY_FILE")
+		os.Unsetenv("STATSD_ADDRESS")
+		os.Unsetenv("STATSD_PREFIX")
+		os.Unsetenv("STATSD_TAGS")
+		os.Unsetenv("STATSD_SAMPLE_RATES")
+		os.Unsetenv("DISABLE_LISTENER")
+		os.Unsetenv("ONCE")
+		os.Unsetenv("LOG_FORMAT")
+		os.Unsetenv("LOG_LEVEL")
 		os.Unsetenv("DEBUG")
+		os.Unsetenv("TOP_QUERIES_COUNT")
+		os.Unsetenv("TOP_ADS_COUNT")
+		os.Unsetenv("TOP_SOURCES_COUNT")
+		os.Unsetenv("TOP_SOURCES_BLOCKED_COUNT")
+		os.Unsetenv("TOP_CLIENT_ADS_COUNT")
+		os.Unsetenv("TOP_UPSTREAMS_RESPONSETIME_COUNT")
 
 		loadedEnvConfig, loadedClientsConfig, err := Load()
 		if err != nil {
@@ -301,19 +686,41 @@ func TestLoadConfigDefaults(t *testing.T) {
 		}
 
 		expectedEnvConfig := &EnvConfig{
-			PIHoleProtocol:      []string{"http"},
-			PIHoleHostname:      []string{"127.0.0.1"},
-			PIHolePort:          []uint16{80},
-			PIHolePassword:      []string{},
-			BindAddr:            "0.0.0.0",
-			Port:                9617,
-			Timeout:             5 * time.Second,
-			SkipTLSVerification: false,
-			Debug:               false,
+			PIHoleProtocol:         []string{"http"},
+			PIHoleHostname:         []string{"127.0.0.1"},
+			PIHolePort:             []uint16{80},
+			PIHolePassword:         []string{},
+			TopQueriesCount:        []uint{DefaultTopSize},
+			TopAdsCount:            []uint{DefaultTopSize},
+			TopSourcesCount:        []uint{DefaultTopSize},
+			TopSourcesBlockedCount: []uint{DefaultTopSize},
+			TopClientAdsCount:      []uint{0},
+			TopUpstreamsCount:      []uint{0},
+			BindAddr:               "0.0.0.0",
+			Port:                   9617,
+			Timeout:                5 * time.Second,
+			ScrapeTimeout:          DefaultScrapeTimeout,
+			ScrapeTimeoutOffset:    DefaultScrapeTimeoutOffset,
+			ShutdownGracePeriod:    DefaultShutdownGracePeriod,
+			SkipTLSVerification:    false,
+			ReadinessMode:          ReadinessModeNone,
+			ReadinessMaxAge:        DefaultReadinessMaxAge,
+			ReplyTimeBuckets:       DefaultReplyTimeBuckets,
+			PushInterval:           DefaultPushInterval,
+			InfluxDBMeasurement:    DefaultInfluxDBMeasurement,
+			InfluxDBBatchSize:      DefaultInfluxDBBatchSize,
+			OTLPMetricsProtocol:    OTLPProtocolHTTP,
+			PushgatewayJob:         DefaultPushgatewayJob,
+			MQTTClientID:           DefaultMQTTClientID,
+			MQTTTopicPrefix:        DefaultMQTTTopicPrefix,
+			MQTTDiscoveryPrefix:    DefaultMQTTDiscoveryPrefix,
+			LogFormat:              LogFormatText,
+			LogLevel:               "info",
+			Debug:                  false,
 		}
 
 		expectedClients := []Config{
-			{PIHoleProtocol: "http", PIHoleHostname: "127.0.0.1", PIHolePort: 80, PIHolePassword: ""},
+			{PIHoleProtocol: "http", PIHoleHostname: "127.0.0.1", PIHolePort: 80, PIHolePassword: "", TopLists: defaultTopLists},
 		}
 
 		if !reflect.DeepEqual(loadedEnvConfig, expectedEnvConfig) {
@@ -328,6 +735,62 @@ func TestLoadConfigDefaults(t *testing.T) {
 	})
 }
 
+func TestLoadConfigFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "pihole-exporter.yml")
+	err := os.WriteFile(configFile, []byte(`pihole_hostname: [pi1.lan, pi2.lan]
+pihole_password: [secret1, secret2]
+pihole_port: [80]
+top_ads_count: [0]
+timeout: 3s
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONFIG_FILE", configFile)
+	t.Setenv("PIHOLE_PORT", "8080")
+
+	withArgs([]string{"pihole-exporter", "-timeout=4s"}, func() {
+		loadedEnvConfig, loadedClientsConfig, err := Load()
+		if err != nil {
+			t.Fatalf("Load() returned an unexpected error: %v", err)
+		}
+
+		assert.Equal(t, configFile, loadedEnvConfig.ConfigFile)
+		assert.Equal(t, 4*time.Second, loadedEnvConfig.Timeout, "flags must take precedence over the file")
+
+		topLists := defaultTopLists
+		topLists.Ads = 0
+		assert.Equal(t, []Config{
+			{PIHoleProtocol: "http", PIHoleHostname: "pi1.lan", PIHolePort: 8080, PIHolePassword: "secret1", TopLists: topLists},
+			{PIHoleProtocol: "http", PIHoleHostname: "pi2.lan", PIHolePort: 8080, PIHolePassword: "secret2", TopLists: topLists},
+		}, loadedClientsConfig)
+	})
+
+	// Loading again, as on reload, must pick up the changes of the file.
+	err = os.WriteFile(configFile, []byte("pihole_hostname: [pi3.lan]\npihole_protocol: [ftp]\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withArgs([]string{"pihole-exporter"}, func() {
+		_, _, err := Load()
+		assert.Error(t, err, "invalid protocol must be rejected")
+	})
+}
+
+// TestLoadConfigFlagsParsedOnce tests that a reload reuses the flags parsed on startup
+func TestLoadConfigFlagsParsedOnce(t *testing.T) {
+	withArgs([]string{"pihole-exporter", "-timeout=4s"}, func() {
+		_, _, err := Load()
+		require.NoError(t, err)
+
+		os.Args = []string{"pihole-exporter", "-timeout=5s"}
+		loadedEnvConfig, _, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, 4*time.Second, loadedEnvConfig.Timeout)
+	})
+}
+
 // Remove the old test function that combined everything
 func TestLoadConfig(t *testing.T) {
 	t.Skip("This test uses flags which can cause flag redefinition errors. Use separate test functions instead.")
@@ -380,6 +843,7 @@ func TestLoadConfigSingleCase(t *testing.T) {
 		PIHoleHostname: "pi.hole",
 		PIHolePort:     80,
 		PIHolePassword: "",
+		TopLists:       defaultTopLists,
 	}
 
 	if len(loadedClientsConfig) != 1 || !reflect.DeepEqual(loadedClientsConfig[0], expected) {
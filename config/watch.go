@@ -0,0 +1,84 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// WatchDebounce is the delay without change to the configuration file after
+// which a change is notified, editors often writing a file in several steps.
+const WatchDebounce = 500 * time.Millisecond
+
+// Watch calls onChange each time the configuration file at path changes, until
+// ctx is cancelled. The parent directory is watched rather than the file, so
+// that files replaced by a rename (editors, Kubernetes ConfigMap symlinks) keep
+// being followed.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create configuration file watcher: %w", err)
+	}
+
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to watch configuration directory %s: %w", dir, err)
+	}
+
+	go func() {
+		defer func() {
+			if err := watcher.Close(); err != nil {
+				log.Warnf("Failed to close configuration file watcher: %v", err)
+			}
+		}()
+
+		timer := time.NewTimer(WatchDebounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isConfigEvent(event, path) {
+					continue
+				}
+				log.Debugf("Configuration file event: %s", event)
+				timer.Reset(WatchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("Configuration file watcher error: %v", err)
+			case <-timer.C:
+				log.Infof("Configuration file %s changed", path)
+				onChange()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// isConfigEvent tells if event may have changed the content of the
+// configuration file at path.
+func isConfigEvent(event fsnotify.Event, path string) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+		return false
+	}
+	if filepath.Clean(event.Name) == path {
+		return true
+	}
+	// Kubernetes updates mounted ConfigMaps by swapping the ..data symlink.
+	return filepath.Base(event.Name) == "..data"
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pihole-exporter.yml")
+	require.NoError(t, os.WriteFile(path, []byte("pihole_hostname: [pi1.lan]\n"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 10)
+	require.NoError(t, Watch(ctx, path, func() { changes <- struct{}{} }))
+
+	// Unrelated files of the directory are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.yml"), []byte("x"), 0o600))
+	select {
+	case <-changes:
+		t.Fatal("unexpected change notification for another file")
+	case <-time.After(2 * WatchDebounce):
+	}
+
+	// Several writes in a row are notified once.
+	require.NoError(t, os.WriteFile(path, []byte("pihole_hostname: [pi1.lan, pi2.lan]\n"), 0o600))
+	require.NoError(t, os.WriteFile(path, []byte("pihole_hostname: [pi1.lan, pi3.lan]\n"), 0o600))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+
+	// A file replaced by a rename is still followed.
+	tmp := filepath.Join(dir, "pihole-exporter.yml.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("pihole_hostname: [pi4.lan]\n"), 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification after rename")
+	}
+
+	assert.Empty(t, changes)
+}
@@ -0,0 +1,114 @@
+package fleet
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+var (
+	instancesDesc = prometheus.NewDesc("pihole_fleet_instances",
+		"This represent the number of Pi-hole instances aggregated in the fleet metrics", nil, nil)
+	queriesDesc = prometheus.NewDesc("pihole_fleet_dns_queries_today",
+		"This represent the number of DNS queries made over the current day across all Pi-hole instances", nil, nil)
+	blockedDesc = prometheus.NewDesc("pihole_fleet_ads_blocked_today",
+		"This represent the number of ads blocked over the current day across all Pi-hole instances", nil, nil)
+	percentageDesc = prometheus.NewDesc("pihole_fleet_ads_percentage_today",
+		"This represent the percentage of ads blocked over the current day across all Pi-hole instances, weighted by their queries", nil, nil)
+	ratioDesc = prometheus.NewDesc("pihole_fleet_ads_today_ratio",
+		"This represent the ratio of ads blocked over the current day across all Pi-hole instances, weighted by their queries, from 0 to 1", nil, nil)
+	blockingDisabledDesc = prometheus.NewDesc("pihole_fleet_blocking_disabled",
+		"This represent the number of Pi-hole instances with blocking disabled", nil, nil)
+	topQueriesDesc = prometheus.NewDesc("pihole_fleet_top_queries",
+		"This represent the number of queries by domain across the top queries of all Pi-hole instances", []string{"domain"}, nil)
+	topAdsDesc = prometheus.NewDesc("pihole_fleet_top_ads",
+		"This represent the number of ads by domain across the top ads of all Pi-hole instances", []string{"domain"}, nil)
+)
+
+// Collector exports aggregates of the last snapshot of every target, for the
+// instances serving the same clients behind a load-balanced address. They are
+// apart from the per hostname metrics, which keeps the sums over the hostname
+// label right.
+type Collector struct {
+	targets func() []*pihole.Client
+	ratios  bool
+	maxAge  time.Duration
+}
+
+// NewCollector returns a Collector of the targets, exporting the ratio of ads
+// blocked from 0 to 1 rather than a percentage with ratios. The targets whose
+// last collection failed or ended more than maxAge ago are left out.
+func NewCollector(targets func() []*pihole.Client, ratios bool, maxAge time.Duration) *Collector {
+	return &Collector{targets: targets, ratios: ratios, maxAge: maxAge}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instancesDesc
+	ch <- queriesDesc
+	ch <- blockedDesc
+	if c.ratios {
+		ch <- ratioDesc
+	} else {
+		ch <- percentageDesc
+	}
+	ch <- blockingDisabledDesc
+	ch <- topQueriesDesc
+	ch <- topAdsDesc
+}
+
+// Collect implements prometheus.Collector. Only the targets whose last
+// collection succeeded within maxAge are aggregated, the snapshot of the others
+// being stale.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	var instances, queries, blocked, blockingDisabled int
+	topQueries := map[string]int{}
+	topAds := map[string]int{}
+	for _, target := range c.targets() {
+		state := target.LastScrape()
+		if state.Status == nil || state.Status.Status != pihole.MetricsCollectionSuccess || time.Since(state.Time) > c.maxAge {
+			continue
+		}
+		snapshot := target.Snapshot()
+		if snapshot == nil {
+			continue
+		}
+
+		instances++
+		queries += snapshot.Summary.QueriesTotal
+		blocked += snapshot.Summary.QueriesBlocked
+		if snapshot.Blocking.State == "disabled" {
+			blockingDisabled++
+		}
+		// A domain missing from the top list of an instance is counted as
+		// none there.
+		for _, entry := range snapshot.TopLists.Queries {
+			topQueries[entry.Domain] += entry.Count
+		}
+		for _, entry := range snapshot.TopLists.Ads {
+			topAds[entry.Domain] += entry.Count
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(instancesDesc, prometheus.GaugeValue, float64(instances))
+	ch <- prometheus.MustNewConstMetric(queriesDesc, prometheus.GaugeValue, float64(queries))
+	ch <- prometheus.MustNewConstMetric(blockedDesc, prometheus.GaugeValue, float64(blocked))
+	var ratio float64
+	if queries > 0 {
+		ratio = float64(blocked) / float64(queries)
+	}
+	if c.ratios {
+		ch <- prometheus.MustNewConstMetric(ratioDesc, prometheus.GaugeValue, ratio)
+	} else {
+		ch <- prometheus.MustNewConstMetric(percentageDesc, prometheus.GaugeValue, ratio*100)
+	}
+	ch <- prometheus.MustNewConstMetric(blockingDisabledDesc, prometheus.GaugeValue, float64(blockingDisabled))
+	for domain, count := range topQueries {
+		ch <- prometheus.MustNewConstMetric(topQueriesDesc, prometheus.GaugeValue, float64(count), domain)
+	}
+	for domain, count := range topAds {
+		ch <- prometheus.MustNewConstMetric(topAdsDesc, prometheus.GaugeValue, float64(count), domain)
+	}
+}
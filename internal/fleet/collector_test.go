@@ -0,0 +1,140 @@
+package fleet_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/fleet"
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+// newTarget returns a Pi-hole client of hostname collected once from a fake
+// API with the given summary, blocking state and top domains.
+func newTarget(t *testing.T, hostname string, total, blocked int, blocking string, queries, ads map[string]int) *pihole.Client {
+	t.Helper()
+	topDomains := func(counts map[string]int) map[string]any {
+		var domains []map[string]any
+		for domain, count := range counts {
+			domains = append(domains, map[string]any{"domain": domain, "count": count})
+		}
+		return map[string]any{"domains": domains}
+	}
+	stub := piholetest.NewServer(t, map[string]any{
+		"/api/stats/summary":   map[string]any{"queries": map[string]any{"total": total, "blocked": blocked}},
+		"/api/stats/upstreams": map[string]any{},
+		"/api/dns/blocking":    map[string]any{"blocking": blocking},
+		"/api/info/version":    map[string]any{},
+		"/api/stats/top_domains": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("blocked") == "true" {
+				_ = json.NewEncoder(w).Encode(topDomains(ads))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(topDomains(queries))
+		}),
+	})
+
+	cfg := piholetest.Config(t, stub, hostname, "secret")
+	cfg.TopLists = config.TopListsConfig{Queries: 10, Ads: 10}
+	client := pihole.NewClient(&cfg, &config.EnvConfig{Timeout: time.Second})
+	t.Cleanup(client.Close)
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	return client
+}
+
+// gather returns the values of the metrics of collector by series.
+func gather(t *testing.T, collector prometheus.Collector) map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			series := family.GetName()
+			for _, label := range metric.GetLabel() {
+				series += fmt.Sprintf("{%s=%q}", label.GetName(), label.GetValue())
+			}
+			values[series] = metric.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+// TestCollector tests the aggregates of the targets, the blocked percentage being weighted by their queries
+func TestCollector(t *testing.T) {
+	targets := []*pihole.Client{
+		newTarget(t, "127.0.0.1", 1000, 100, "enabled", map[string]int{"example.com": 30, "pi.hole": 10}, map[string]int{"ads.example.com": 20}),
+		newTarget(t, "localhost", 3000, 900, "disabled", map[string]int{"example.com": 50}, map[string]int{"tracker.example.com": 5}),
+	}
+	collector := fleet.NewCollector(func() []*pihole.Client { return targets }, false, time.Minute)
+
+	assert.Equal(t, map[string]float64{
+		"pihole_fleet_instances":                             2,
+		"pihole_fleet_dns_queries_today":                     4000,
+		"pihole_fleet_ads_blocked_today":                     1000,
+		"pihole_fleet_ads_percentage_today":                  25,
+		"pihole_fleet_blocking_disabled":                     1,
+		`pihole_fleet_top_queries{domain="example.com"}`:     80,
+		`pihole_fleet_top_queries{domain="pi.hole"}`:         10,
+		`pihole_fleet_top_ads{domain="ads.example.com"}`:     20,
+		`pihole_fleet_top_ads{domain="tracker.example.com"}`: 5,
+	}, gather(t, collector))
+}
+
+// TestCollector_Ratio tests that the blocked ratio is exported from 0 to 1 and the targets not collected yet are left out
+func TestCollector_Ratio(t *testing.T) {
+	targets := []*pihole.Client{
+		newTarget(t, "127.0.0.1", 1000, 100, "enabled", nil, nil),
+		pihole.NewClient(&config.Config{PIHoleProtocol: "http", PIHoleHostname: "localhost", PIHolePort: 80, PIHolePassword: "secret"}, &config.EnvConfig{Timeout: time.Second}),
+	}
+	collector := fleet.NewCollector(func() []*pihole.Client { return targets }, true, time.Minute)
+
+	values := gather(t, collector)
+	assert.Equal(t, 0.1, values["pihole_fleet_ads_today_ratio"])
+	assert.Equal(t, 1.0, values["pihole_fleet_instances"])
+	assert.NotContains(t, values, "pihole_fleet_ads_percentage_today")
+}
+
+// TestCollector_Stale tests that the targets whose last collection failed or is too old are left out
+func TestCollector_Stale(t *testing.T) {
+	var failing atomic.Bool
+	stub := piholetest.NewServer(t, map[string]any{
+		"/api/stats/summary": http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{"queries":{"total":1000,"blocked":100}}`))
+		}),
+		"/api/stats/upstreams": map[string]any{},
+		"/api/dns/blocking":    map[string]any{"blocking": "enabled"},
+	})
+	failed := piholetest.NewClient(t, stub, "localhost", &config.EnvConfig{Timeout: time.Second})
+	require.NoError(t, failed.CollectMetrics(context.Background()))
+	failing.Store(true)
+	require.Error(t, failed.CollectMetrics(context.Background()))
+	require.NotNil(t, failed.Snapshot(), "the snapshot of the last successful collection is kept")
+
+	healthy := newTarget(t, "127.0.0.1", 3000, 900, "enabled", nil, nil)
+	targets := []*pihole.Client{healthy, failed}
+
+	values := gather(t, fleet.NewCollector(func() []*pihole.Client { return targets }, false, time.Minute))
+	assert.Equal(t, 1.0, values["pihole_fleet_instances"])
+	assert.Equal(t, 3000.0, values["pihole_fleet_dns_queries_today"])
+
+	values = gather(t, fleet.NewCollector(func() []*pihole.Client { return targets }, false, time.Nanosecond))
+	assert.Equal(t, 0.0, values["pihole_fleet_instances"])
+}
@@ -0,0 +1,67 @@
+package influxdb
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/eko/pihole-exporter/internal/push"
+)
+
+// Encode converts the metric families into InfluxDB line protocol, with the
+// layout of the Telegraf Prometheus input (metric_version = 2) the dashboards
+// expect: a single measurement, the metric name as field and its labels as
+// tags. Histograms and summaries are split into their _bucket (le tag) or
+// quantile, _sum and _count fields. The timestamps are in milliseconds.
+func Encode(families []*dto.MetricFamily, measurement string, timestamp time.Time) []string {
+	samples := push.Flatten(families)
+	lines := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		// Line protocol has no representation of NaN and infinities.
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		lines = append(lines, encodeLine(measurement, sample, timestamp))
+	}
+	return lines
+}
+
+func encodeLine(measurement string, sample push.Sample, timestamp time.Time) string {
+	tags := make([]*dto.LabelPair, 0, len(sample.Labels))
+	for _, label := range sample.Labels {
+		// Line protocol does not allow empty tag values.
+		if label.GetValue() != "" {
+			tags = append(tags, label)
+		}
+	}
+	// InfluxDB recommends sorting the tags by key.
+	sort.Slice(tags, func(i, j int) bool { return tags[i].GetName() < tags[j].GetName() })
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+	for _, tag := range tags {
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(tag.GetName()))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(tag.GetValue()))
+	}
+	b.WriteByte(' ')
+	b.WriteString(keyEscaper.Replace(sample.Name))
+	b.WriteByte('=')
+	b.WriteString(strconv.FormatFloat(sample.Value, 'g', -1, 64))
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(timestamp.UnixMilli(), 10))
+	return b.String()
+}
+
+var (
+	// measurementEscaper escapes the special characters of measurements.
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	// keyEscaper escapes the special characters of tag keys, tag values and
+	// field keys.
+	keyEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+)
@@ -0,0 +1,249 @@
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/push"
+	"github.com/eko/pihole-exporter/internal/queue"
+)
+
+const (
+	// DefaultBufferMaxBytes is the maximum size of the on-disk buffer.
+	DefaultBufferMaxBytes = 64 << 20
+
+	// sinkName identifies the InfluxDB sink in the logs and metrics.
+	sinkName = "influxdb"
+	// maxAttempts is the number of times a batch is written before it is
+	// buffered.
+	maxAttempts = 3
+	// maxBackoff caps the wait between two attempts.
+	maxBackoff = 30 * time.Second
+)
+
+// Options configures a Writer.
+type Options struct {
+	// URL is the base URL of InfluxDB, such as http://influxdb:8086.
+	URL         string
+	Org         string
+	Bucket      string
+	Token       string
+	Measurement string
+	// BatchSize is the maximum number of lines per write request.
+	BatchSize int
+	// BufferPath is the directory keeping the batches that could not be
+	// written, none are kept when empty.
+	BufferPath     string
+	BufferMaxBytes int64
+	// Timeout is the timeout of each write request.
+	Timeout time.Duration
+}
+
+// Writer pushes the metrics to the /api/v2/write endpoint of InfluxDB in line
+// protocol. The batches failing with a server or network error are retried
+// with an exponential backoff, then kept in the buffer until InfluxDB is back.
+type Writer struct {
+	writeURL    string
+	token       string
+	measurement string
+	batchSize   int
+	client      *http.Client
+	buffer      *queue.Queue
+	// backoff is the wait before the second attempt of a batch, doubled for
+	// each of the next ones.
+	backoff time.Duration
+
+	mu sync.Mutex
+}
+
+// NewWriter returns a Writer to the InfluxDB of opts.
+func NewWriter(opts Options) (*Writer, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid InfluxDB URL: %w", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+	u.RawQuery = url.Values{"org": {opts.Org}, "bucket": {opts.Bucket}, "precision": {"ms"}}.Encode()
+
+	w := &Writer{
+		writeURL:    u.String(),
+		token:       opts.Token,
+		measurement: opts.Measurement,
+		batchSize:   opts.BatchSize,
+		client:      &http.Client{Timeout: opts.Timeout},
+		backoff:     time.Second,
+	}
+	if w.batchSize <= 0 {
+		return nil, fmt.Errorf("invalid InfluxDB batch size %d: must be positive", w.batchSize)
+	}
+
+	if opts.BufferPath != "" {
+		maxBytes := opts.BufferMaxBytes
+		if maxBytes <= 0 {
+			maxBytes = DefaultBufferMaxBytes
+		}
+		if w.buffer, err = queue.Open(opts.BufferPath, maxBytes); err != nil {
+			return nil, err
+		}
+		metrics.PushBufferBytes.WithLabelValues(sinkName).Set(float64(w.buffer.Size()))
+	}
+	return w, nil
+}
+
+// Name implements push.Sink.
+func (w *Writer) Name() string {
+	return sinkName
+}
+
+// Push implements push.Sink. The buffered batches are written first, to keep
+// the points in order, and the new ones are buffered as long as InfluxDB is
+// unreachable.
+func (w *Writer) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lines := Encode(families, w.measurement, timestamp)
+	available := w.flushBuffer(ctx)
+
+	var errs []error
+	for start := 0; start < len(lines); start += w.batchSize {
+		batch := []byte(strings.Join(lines[start:min(start+w.batchSize, len(lines))], "\n"))
+
+		if available {
+			err := w.writeWithRetry(ctx, batch)
+			if err == nil {
+				metrics.PushBatches.WithLabelValues(sinkName, "success").Inc()
+				continue
+			}
+			if !push.IsRetryable(err) {
+				metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+				errs = append(errs, err)
+				continue
+			}
+			available = false
+			errs = append(errs, err)
+		}
+
+		if err := w.bufferBatch(batch); err != nil {
+			metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flushBuffer writes the buffered batches, oldest first, and tells whether
+// InfluxDB is available.
+func (w *Writer) flushBuffer(ctx context.Context) bool {
+	if w.buffer == nil {
+		return true
+	}
+	defer func() { metrics.PushBufferBytes.WithLabelValues(sinkName).Set(float64(w.buffer.Size())) }()
+
+	for {
+		entry, found, err := w.buffer.Peek()
+		if err != nil {
+			w.logger().Warnf("Failed to read buffered batch: %v", err)
+			return true
+		}
+		if !found {
+			return true
+		}
+
+		// A single attempt, the batch stays buffered on failure.
+		if err := w.write(ctx, entry.Data); err != nil {
+			if push.IsRetryable(err) {
+				w.logger().Debugf("InfluxDB still unavailable, %d batch(es) buffered: %v", w.buffer.Len(), err)
+				return false
+			}
+			metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+			w.logger().Errorf("Dropping buffered batch rejected by InfluxDB: %v", err)
+		} else {
+			metrics.PushBatches.WithLabelValues(sinkName, "success").Inc()
+		}
+		if err := w.buffer.Remove(entry); err != nil {
+			w.logger().Warnf("Failed to remove buffered batch: %v", err)
+			return true
+		}
+	}
+}
+
+// bufferBatch keeps a batch that could not be written, if there is a buffer.
+func (w *Writer) bufferBatch(batch []byte) error {
+	if w.buffer == nil {
+		return errors.New("batch dropped, no buffer path configured")
+	}
+	dropped, err := w.buffer.Push(batch)
+	metrics.PushBatches.WithLabelValues(sinkName, "dropped").Add(float64(dropped))
+	if err != nil {
+		return err
+	}
+	metrics.PushBatches.WithLabelValues(sinkName, "buffered").Inc()
+	metrics.PushBufferBytes.WithLabelValues(sinkName).Set(float64(w.buffer.Size()))
+	return nil
+}
+
+// writeWithRetry writes a batch, retrying the server and network errors with
+// an exponential backoff, or after the delay requested by InfluxDB.
+func (w *Writer) writeWithRetry(ctx context.Context, batch []byte) error {
+	for attempt := 1; ; attempt++ {
+		err := w.write(ctx, batch)
+		if err == nil || !push.IsRetryable(err) || attempt == maxAttempts {
+			return err
+		}
+
+		wait := min(w.backoff<<(attempt-1), maxBackoff)
+		if retryAfter := push.RetryAfter(err); retryAfter > 0 {
+			wait = min(retryAfter, maxBackoff)
+		}
+		w.logger().Debugf("Write attempt %d failed, retrying in %s: %v", attempt, wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// write sends a batch in a single request.
+func (w *Writer) write(ctx context.Context, batch []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.writeURL, bytes.NewReader(batch))
+	if err != nil {
+		return fmt.Errorf("failed to create InfluxDB write request: %w", err)
+	}
+	req.Header.Set("Authorization", "Token "+w.token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	// InfluxDB describes the error in a short JSON body.
+	return push.NewStatusError("InfluxDB write", resp)
+}
+
+func (w *Writer) logger() *log.Entry {
+	return log.WithField("sink", sinkName)
+}
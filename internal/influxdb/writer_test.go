@@ -0,0 +1,187 @@
+package influxdb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// influxStub is a fake InfluxDB recording the written batches, and answering
+// with the given status codes before accepting them.
+type influxStub struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	batches  []string
+}
+
+func (s *influxStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r)
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"code":"internal error","message":"unavailable"}`))
+		return
+	}
+	s.batches = append(s.batches, string(body))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *influxStub) fail(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = append(s.statuses, statuses...)
+}
+
+func (s *influxStub) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.batches...)
+}
+
+func gather(t *testing.T, values map[string]float64) []*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_reply"}, []string{"hostname", "type"})
+	registry.MustRegister(gauge)
+	for replyType, value := range values {
+		gauge.WithLabelValues("127.0.0.1", replyType).Set(value)
+	}
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	return families
+}
+
+func newTestWriter(t *testing.T, url string, batchSize int, bufferPath string) *Writer {
+	t.Helper()
+	w, err := NewWriter(Options{
+		URL:         url,
+		Org:         "home",
+		Bucket:      "pihole",
+		Token:       "secret",
+		Measurement: "prometheus",
+		BatchSize:   batchSize,
+		BufferPath:  bufferPath,
+		Timeout:     time.Second,
+	})
+	require.NoError(t, err)
+	w.backoff = time.Millisecond
+	return w
+}
+
+// TestEncode tests the line protocol of each metric type
+func TestEncode(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_top_queries"}, []string{"hostname", "domain", "empty"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "pihole_reply_time_seconds", Buckets: []float64{0.1, 1}})
+	registry.MustRegister(gauge, histogram)
+	gauge.WithLabelValues("pi hole", "a=b,c", "").Set(12)
+	histogram.Observe(0.5)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	lines := Encode(families, "pi,hole", time.UnixMilli(1700000000000))
+	assert.Equal(t, []string{
+		`pi\,hole,le=0.1 pihole_reply_time_seconds_bucket=0 1700000000000`,
+		`pi\,hole,le=1 pihole_reply_time_seconds_bucket=1 1700000000000`,
+		`pi\,hole,le=+Inf pihole_reply_time_seconds_bucket=1 1700000000000`,
+		`pi\,hole pihole_reply_time_seconds_sum=0.5 1700000000000`,
+		`pi\,hole pihole_reply_time_seconds_count=1 1700000000000`,
+		`pi\,hole,domain=a\=b\,c,hostname=pi\ hole pihole_top_queries=12 1700000000000`,
+	}, lines)
+}
+
+// TestWriter_Push tests that the metrics are written in batches to the write endpoint
+func TestWriter_Push(t *testing.T) {
+	stub := &influxStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	w := newTestWriter(t, server.URL+"/", 2, "")
+	families := gather(t, map[string]float64{"A": 1, "AAAA": 2, "CNAME": 3})
+	require.NoError(t, w.Push(context.Background(), families, time.UnixMilli(1000)))
+
+	assert.Equal(t, []string{
+		"prometheus,hostname=127.0.0.1,type=A pihole_reply=1 1000\nprometheus,hostname=127.0.0.1,type=AAAA pihole_reply=2 1000",
+		"prometheus,hostname=127.0.0.1,type=CNAME pihole_reply=3 1000",
+	}, stub.written())
+	request := stub.requests[0]
+	assert.Equal(t, "/api/v2/write", request.URL.Path)
+	assert.Equal(t, "home", request.URL.Query().Get("org"))
+	assert.Equal(t, "pihole", request.URL.Query().Get("bucket"))
+	assert.Equal(t, "ms", request.URL.Query().Get("precision"))
+	assert.Equal(t, "Token secret", request.Header.Get("Authorization"))
+}
+
+// TestWriter_Retry tests that the server errors are retried and the rejected batches dropped
+func TestWriter_Retry(t *testing.T) {
+	stub := &influxStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	w := newTestWriter(t, server.URL, 10, t.TempDir())
+	families := gather(t, map[string]float64{"A": 1})
+
+	stub.fail(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	require.NoError(t, w.Push(context.Background(), families, time.UnixMilli(1000)))
+	assert.Len(t, stub.written(), 1)
+	assert.Len(t, stub.requests, 3)
+
+	stub.fail(http.StatusBadRequest)
+	assert.ErrorContains(t, w.Push(context.Background(), families, time.UnixMilli(2000)), "status code 400")
+	assert.Len(t, stub.written(), 1, "a rejected batch must not be retried")
+	assert.Zero(t, w.buffer.Size(), "a rejected batch must not be buffered")
+}
+
+// TestWriter_Buffer tests that the batches are kept on disk during an outage
+// and written in order once InfluxDB is back
+func TestWriter_Buffer(t *testing.T) {
+	stub := &influxStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	dir := t.TempDir()
+	w := newTestWriter(t, server.URL, 10, dir)
+
+	stub.fail(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	assert.Error(t, w.Push(context.Background(), gather(t, map[string]float64{"A": 1}), time.UnixMilli(1000)))
+	// InfluxDB is still down, the next batch is buffered without retry.
+	stub.fail(http.StatusInternalServerError)
+	assert.NoError(t, w.Push(context.Background(), gather(t, map[string]float64{"A": 2}), time.UnixMilli(2000)))
+	assert.Empty(t, stub.written())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// A restarted exporter picks the buffer up.
+	w = newTestWriter(t, server.URL, 10, dir)
+	assert.Positive(t, w.buffer.Size())
+	require.NoError(t, w.Push(context.Background(), gather(t, map[string]float64{"A": 3}), time.UnixMilli(3000)))
+
+	written := stub.written()
+	require.Len(t, written, 3)
+	for i, timestamp := range []string{"1000", "2000", "3000"} {
+		assert.True(t, strings.HasSuffix(written[i], " "+timestamp), written[i])
+	}
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Zero(t, w.buffer.Size())
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
+	log "github.com/sirupsen/logrus"
+)
+
+// Registry holds the metrics about the exporter itself rather than about
+// Pi-hole: build information, Go runtime and process, and requests made to
+// the Pi-hole API.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// FTLRequests - The number of requests made to the Pi-hole API.
+	FTLRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "ftl_requests_total",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent the number of requests made to the Pi-hole API by endpoint and status code",
+		},
+		[]string{"hostname", "method", "endpoint", "code"},
+	)
+
+	// FTLRequestDuration - The duration of the requests made to the Pi-hole API.
+	FTLRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:      "ftl_request_duration_seconds",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent the duration of the requests made to the Pi-hole API by endpoint",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+		[]string{"hostname", "method", "endpoint"},
+	)
+
+	// AuthAttempts - The number of authentications to the Pi-hole API.
+	AuthAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "auth_attempts_total",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent the number of authentications to the Pi-hole API by result: success, failure or error",
+		},
+		[]string{"hostname", "result"},
+	)
+
+	// PushBatches - The number of batches pushed to a sink.
+	PushBatches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "push_batches_total",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent the number of batches pushed to a sink by result: success, buffered or dropped",
+		},
+		[]string{"sink", "result"},
+	)
+
+	// PushBufferBytes - The size of the batches buffered for a sink.
+	PushBufferBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "push_buffer_bytes",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent the size of the batches buffered on disk until a sink is available",
+		},
+		[]string{"sink"},
+	)
+)
+
+// InitExporter registers the metrics about the exporter itself in Registry.
+// The Go runtime and process metrics are moved there from the default
+// registry, which only holds the Pi-hole metrics afterwards.
+func InitExporter() {
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.Unregister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		versioncollector.NewCollector("pihole_exporter"),
+		FTLRequests,
+		FTLRequestDuration,
+		AuthAttempts,
+		PushBatches,
+		PushBufferBytes,
+	)
+	log.Debug("Exporter metrics registered")
+}
+
+// deleteExporterHostname removes the series of the exporter metrics about the
+// given Pi-hole hostname.
+func deleteExporterHostname(hostname string) {
+	labels := prometheus.Labels{"hostname": hostname}
+	FTLRequests.DeletePartialMatch(labels)
+	FTLRequestDuration.DeletePartialMatch(labels)
+	AuthAttempts.DeletePartialMatch(labels)
+}
@@ -1,7 +1,12 @@
 package metrics
 
 import (
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -46,6 +51,16 @@ var (
 		[]string{"hostname"},
 	)
 
+	// AdsRatioToday - The ratio of ads blocked by Pi-hole over the current day.
+	AdsRatioToday = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "ads_today_ratio",
+			Namespace: "pihole",
+			Help:      "This represent the ratio of ads blocked over the current day, from 0 to 1",
+		},
+		[]string{"hostname"},
+	)
+
 	// UniqueDomains - The number of unique domains seen by Pi-hole.
 	UniqueDomains = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -156,6 +171,26 @@ var (
 		[]string{"hostname", "source", "source_name"},
 	)
 
+	// TopSourcesBlocked - The number of top sources blocked requests made by Pi-hole by source host.
+	TopSourcesBlocked = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "top_sources_blocked",
+			Namespace: "pihole",
+			Help:      "This represent the number of top sources blocked requests made by Pi-hole by source host",
+		},
+		[]string{"hostname", "source", "source_name"},
+	)
+
+	// TopClientAds - The number of top ads made by Pi-hole by source host and domain.
+	TopClientAds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "top_client_ads",
+			Namespace: "pihole",
+			Help:      "This represent the number of top ads made by Pi-hole by source host and domain",
+		},
+		[]string{"hostname", "source", "source_name", "domain"},
+	)
+
 	// ForwardDestinations - The number of forward destinations requests made by Pi-hole by destination.
 	ForwardDestinations = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -166,6 +201,9 @@ var (
 		[]string{"hostname", "destination", "destination_name"},
 	)
 
+	// ForwardDestinationsResponseTime - The seconds a forward destination took to
+	// process the requests, kept for compatibility with the dashboards using it,
+	// see ForwardDestinationsResponseTimeSeconds.
 	ForwardDestinationsResponseTime = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:      "forward_destinations_responsetime",
@@ -175,6 +213,17 @@ var (
 		[]string{"hostname", "destination", "destination_name"},
 	)
 
+	// ForwardDestinationsResponseTimeSeconds - The seconds a forward destination
+	// took to process the requests, named after its unit.
+	ForwardDestinationsResponseTimeSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "forward_destinations_responsetime_seconds",
+			Namespace: "pihole",
+			Help:      "This represent the seconds a forward destinations took to process a requests made by Pi-hole",
+		},
+		[]string{"hostname", "destination", "destination_name"},
+	)
+
 	ForwardDestinationsResponseVariance = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:      "forward_destinations_responsevariance",
@@ -184,6 +233,49 @@ var (
 		[]string{"hostname", "destination", "destination_name"},
 	)
 
+	// TopUpstreamsResponseTime - The slowest forward destinations by average response time.
+	TopUpstreamsResponseTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "top_upstreams_responsetime",
+			Namespace: "pihole",
+			Help:      "This represent the seconds the slowest forward destinations took to process a requests made by Pi-hole",
+		},
+		[]string{"hostname", "destination", "destination_name"},
+	)
+
+	// TopListEntries - The number of entries exported for each top list.
+	TopListEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "top_list_entries",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent the number of entries exported by the exporter for each top list",
+		},
+		[]string{"hostname", "list"},
+	)
+
+	// ScrapeSuccess - Whether the last scrape collected fresh metrics from Pi-hole.
+	ScrapeSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "scrape_success",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent whether the last scrape collected fresh metrics from the Pi-hole instance",
+		},
+		[]string{"hostname"},
+	)
+
+	// ScrapeTimeout - Whether the last scrape timed out before the collection ended.
+	ScrapeTimeout = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "scrape_timeout",
+			Namespace: "pihole",
+			Subsystem: "exporter",
+			Help:      "This represent whether the last scrape timed out before the collection from the Pi-hole instance ended, its metrics being the previous ones",
+		},
+		[]string{"hostname"},
+	)
+
 	// QueryTypes - The number of queries made by Pi-hole by type.
 	QueryTypes = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -194,6 +286,76 @@ var (
 		[]string{"hostname", "type"},
 	)
 
+	// BlockingState - The blocking state of Pi-hole, one series per state.
+	BlockingState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "blocking_state",
+			Namespace: "pihole",
+			Help:      "This represent the blocking state of Pi-hole, 1 for the current state and 0 for the others",
+		},
+		[]string{"hostname", "state"},
+	)
+
+	// BlockingTimer - The remaining time before the blocking state is reverted.
+	BlockingTimer = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "blocking_timer_seconds",
+			Namespace: "pihole",
+			Help:      "This represent the remaining seconds before a temporary blocking change is reverted, 0 without timer",
+		},
+		[]string{"hostname"},
+	)
+
+	// Groups - The number of groups managed by Pi-hole by state.
+	Groups = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "groups",
+			Namespace: "pihole",
+			Help:      "This represent the number of groups managed by Pi-hole by state",
+		},
+		[]string{"hostname", "state"},
+	)
+
+	// GroupEnabled - Is the group enabled?
+	GroupEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "group_enabled",
+			Namespace: "pihole",
+			Help:      "This represent if a group managed by Pi-hole is enabled",
+		},
+		[]string{"hostname", "group"},
+	)
+
+	// GroupClients - The number of clients assigned to a group.
+	GroupClients = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "group_clients",
+			Namespace: "pihole",
+			Help:      "This represent the number of clients assigned to a group managed by Pi-hole",
+		},
+		[]string{"hostname", "group"},
+	)
+
+	// DomainRules - The number of enabled domain rules by group, type and kind.
+	DomainRules = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "domain_rules",
+			Namespace: "pihole",
+			Help:      "This represent the number of enabled allow or deny, exact or regex domain rules by group",
+		},
+		[]string{"hostname", "group", "type", "kind"},
+	)
+
+	// InventoryHash - The fingerprint of the groups, clients and domains lists.
+	InventoryHash = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "inventory_hash",
+			Namespace: "pihole",
+			Help:      "This represent a hash of the groups, clients or domains list, equal across instances sharing the same configuration",
+		},
+		[]string{"hostname", "list"},
+	)
+
 	// Status - Is Pi-hole enabled?
 	Status = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -205,12 +367,37 @@ var (
 	)
 )
 
+// registeredMetrics holds the metrics registered by Init.
+var registeredMetrics []*prometheus.GaugeVec
+
+// UpstreamReplyTime - The reply time of the upstreams by query type, from the
+// query log. It is nil until InitReplyTime is called.
+var UpstreamReplyTime *prometheus.HistogramVec
+
+// Units holds the unit of the metrics whose name ends with it, sent in their
+// metadata and in the # UNIT line of OpenMetrics. The other metrics have none,
+// which keeps their OpenMetrics name.
+var Units = map[string]string{
+	"pihole_ads_today_ratio":                           "ratio",
+	"pihole_fleet_ads_today_ratio":                     "ratio",
+	"pihole_blocking_timer_seconds":                    "seconds",
+	"pihole_forward_destinations_responsetime_seconds": "seconds",
+	"pihole_upstream_reply_time_seconds":               "seconds",
+	"pihole_exporter_ftl_request_duration_seconds":     "seconds",
+}
+
 // Init initializes all Prometheus metrics made available by Pi-hole exporter.
-func Init() {
+// The percentage of ads blocked is a ratio from 0 to 1 with
+// percentagesAsRatios.
+func Init(percentagesAsRatios bool) {
 	initMetric("domains_blocked", DomainsBlocked)
 	initMetric("dns_queries_today", DNSQueriesToday)
 	initMetric("ads_blocked_today", AdsBlockedToday)
-	initMetric("ads_percentag_today", AdsPercentageToday)
+	if percentagesAsRatios {
+		initMetric("ads_today_ratio", AdsRatioToday)
+	} else {
+		initMetric("ads_percentag_today", AdsPercentageToday)
+	}
 	initMetric("unique_domains", UniqueDomains)
 	initMetric("queries_forwarded", QueriesForwarded)
 	initMetric("queries_cached", QueriesCached)
@@ -221,15 +408,125 @@ func Init() {
 	initMetric("top_queries", TopQueries)
 	initMetric("top_ads", TopAds)
 	initMetric("top_sources", TopSources)
+	initMetric("top_sources_blocked", TopSourcesBlocked)
+	initMetric("top_client_ads", TopClientAds)
 	initMetric("forward_destinations", ForwardDestinations)
 	initMetric("destination_responsetime", ForwardDestinationsResponseTime)
+	initMetric("destination_responsetime_seconds", ForwardDestinationsResponseTimeSeconds)
 	initMetric("destination_responsevariance", ForwardDestinationsResponseVariance)
+	initMetric("top_upstreams_responsetime", TopUpstreamsResponseTime)
+	initMetric("top_list_entries", TopListEntries)
+	initMetric("scrape_success", ScrapeSuccess)
+	initMetric("scrape_timeout", ScrapeTimeout)
 	initMetric("request_rate", RequestRate)
 	initMetric("querytypes", QueryTypes)
 	initMetric("status", Status)
+	initMetric("blocking_state", BlockingState)
+	initMetric("blocking_timer_seconds", BlockingTimer)
+	initMetric("groups", Groups)
+	initMetric("group_enabled", GroupEnabled)
+	initMetric("group_clients", GroupClients)
+	initMetric("domain_rules", DomainRules)
+	initMetric("inventory_hash", InventoryHash)
+}
+
+// InitReplyTime initializes the upstream reply time histograms with the given
+// buckets. A bucket factor greater than 1 adds native histogram buckets, of
+// which each is that factor wider than the previous one.
+func InitReplyTime(buckets []float64, nativeBucketFactor float64) {
+	UpstreamReplyTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:                            "upstream_reply_time_seconds",
+			Namespace:                       "pihole",
+			Help:                            "This represent the time the upstreams took to reply to the queries forwarded by Pi-hole by query type",
+			Buckets:                         buckets,
+			NativeHistogramBucketFactor:     nativeBucketFactor,
+			NativeHistogramMaxBucketNumber:  160,
+			NativeHistogramMinResetDuration: time.Hour,
+		},
+		[]string{"hostname", "upstream", "query_type"},
+	)
+	prometheus.MustRegister(UpstreamReplyTime)
+	log.Debug("New Prometheus metric registered: upstream_reply_time_seconds")
+}
+
+// DeleteHostname removes every series of the given Pi-hole hostname, once it
+// is no longer monitored.
+func DeleteHostname(hostname string) {
+	for _, metric := range registeredMetrics {
+		metric.DeletePartialMatch(prometheus.Labels{"hostname": hostname})
+	}
+	if UpstreamReplyTime != nil {
+		UpstreamReplyTime.DeletePartialMatch(prometheus.Labels{"hostname": hostname})
+	}
+	deleteExporterHostname(hostname)
+	log.Debugf("Prometheus metrics of %s deleted", hostname)
+}
+
+// Series is the value of a series of a gauge vector.
+type Series struct {
+	Labels prometheus.Labels
+	Value  float64
+}
+
+// ReplaceSeries sets the series of metric and deletes its other series of
+// hostname, such as a domain which left a top list. The series are set before
+// the others are deleted, so that a concurrent Gather never sees them missing.
+func ReplaceSeries(metric *prometheus.GaugeVec, hostname string, series []Series) {
+	kept := make(map[string]bool, len(series))
+	for _, s := range series {
+		metric.With(s.Labels).Set(s.Value)
+		kept[seriesKey(s.Labels)] = true
+	}
+
+	collected := make(chan prometheus.Metric)
+	go func() {
+		metric.Collect(collected)
+		close(collected)
+	}()
+	var stale []prometheus.Labels
+	for m := range collected {
+		var written dto.Metric
+		if err := m.Write(&written); err != nil {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for _, pair := range written.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		if labels["hostname"] == hostname && !kept[seriesKey(labels)] {
+			stale = append(stale, labels)
+		}
+	}
+	for _, labels := range stale {
+		metric.Delete(labels)
+	}
+}
+
+// seriesKey identifies a series by its labels.
+func seriesKey(labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name + "=" + labels[name] + "\xff")
+	}
+	return key.String()
+}
+
+// BoolToFloat returns the gauge value of a boolean, 1 when true and 0 otherwise.
+func BoolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
 }
 
 func initMetric(name string, metric *prometheus.GaugeVec) {
 	prometheus.MustRegister(metric)
+	registeredMetrics = append(registeredMetrics, metric)
 	log.Debugf("New Prometheus metric registered: %s", name)
 }
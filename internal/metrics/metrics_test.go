@@ -0,0 +1,32 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+)
+
+// TestReplaceSeries tests that the series of a hostname missing from the new ones are deleted, and only them
+func TestReplaceSeries(t *testing.T) {
+	topAds := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_top_ads"}, []string{"hostname", "domain"})
+	topAds.WithLabelValues("pi1", "left.example.com").Set(1)
+	topAds.WithLabelValues("pi1", "kept.example.com").Set(2)
+	topAds.WithLabelValues("pi2", "left.example.com").Set(3)
+
+	metrics.ReplaceSeries(topAds, "pi1", []metrics.Series{
+		{Labels: prometheus.Labels{"hostname": "pi1", "domain": "kept.example.com"}, Value: 4},
+		{Labels: prometheus.Labels{"hostname": "pi1", "domain": "new.example.com"}, Value: 5},
+	})
+
+	assert.Equal(t, 3, testutil.CollectAndCount(topAds))
+	assert.Equal(t, 4.0, testutil.ToFloat64(topAds.WithLabelValues("pi1", "kept.example.com")))
+	assert.Equal(t, 5.0, testutil.ToFloat64(topAds.WithLabelValues("pi1", "new.example.com")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(topAds.WithLabelValues("pi2", "left.example.com")), "the other hostnames must be kept")
+
+	metrics.ReplaceSeries(topAds, "pi1", nil)
+	assert.Equal(t, 1, testutil.CollectAndCount(topAds))
+}
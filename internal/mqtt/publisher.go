@@ -0,0 +1,389 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+const (
+	// sinkName identifies the MQTT sink in the logs and metrics.
+	sinkName = "mqtt"
+	// qos is the quality of service of every message, at least once.
+	qos = 1
+
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+)
+
+// Options configures a Publisher.
+type Options struct {
+	// URL is the broker address, such as tcp://broker:1883 or ssl://broker:8883.
+	URL      string
+	Username string
+	Password string
+	ClientID string
+	// TopicPrefix is the root of the topics the values are published to.
+	TopicPrefix string
+	// DiscoveryPrefix is the Home Assistant discovery prefix, the discovery
+	// configs are not published when empty.
+	DiscoveryPrefix string
+	// CAFile verifies the broker certificate instead of the system roots,
+	// CertFile and KeyFile authenticate the exporter.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// Timeout is the timeout of the connection, and of each push.
+	Timeout time.Duration
+}
+
+// Publisher publishes the summary of each Pi-hole target to an MQTT broker,
+// for home automation systems such as Home Assistant. The values are retained
+// on <prefix>/<target>/<value>, the availability of the exporter on
+// <prefix>/status, set to offline by the broker when the exporter is gone,
+// and the one of each target on <prefix>/<target>/availability.
+type Publisher struct {
+	client paho.Client
+	// connected is done once the first connection succeeded.
+	connected       paho.Token
+	topicPrefix     string
+	discoveryPrefix string
+	timeout         time.Duration
+	// targets returns the current Pi-hole targets.
+	targets func() []*pihole.Client
+
+	mu sync.Mutex
+	// discovered holds the targets whose discovery configs were published
+	// since the last connection.
+	discovered map[string]bool
+}
+
+// NewPublisher returns a Publisher to the broker of opts, publishing the state
+// of the targets. The connection is retried in the background until it
+// succeeds.
+func NewPublisher(opts Options, targets func() []*pihole.Client) (*Publisher, error) {
+	p := &Publisher{
+		timeout:         opts.Timeout,
+		topicPrefix:     opts.TopicPrefix,
+		discoveryPrefix: opts.DiscoveryPrefix,
+		targets:         targets,
+		discovered:      make(map[string]bool),
+	}
+
+	clientOpts := paho.NewClientOptions().
+		AddBroker(opts.URL).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetConnectTimeout(opts.Timeout).
+		SetWriteTimeout(opts.Timeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(p.statusTopic(), payloadOffline, qos, true).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			p.logger().Warnf("Connection to the MQTT broker lost: %v", err)
+		})
+	if opts.CAFile != "" || opts.CertFile != "" {
+		tlsConfig, err := newTLSConfig(opts.CAFile, opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+
+	p.client = paho.NewClient(clientOpts)
+	p.connected = p.client.Connect()
+	return p, nil
+}
+
+// newTLSConfig returns the TLS configuration trusting the CA of caFile, if
+// any, and presenting the client certificate of certFile and keyFile, if any.
+func newTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in MQTT CA file %s", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// onConnect marks the exporter online, the discovery configs being published
+// again on the next push in case the broker lost its retained messages.
+func (p *Publisher) onConnect(client paho.Client) {
+	p.logger().Info("Connected to the MQTT broker")
+	p.mu.Lock()
+	p.discovered = make(map[string]bool)
+	p.mu.Unlock()
+
+	token := client.Publish(p.statusTopic(), qos, true, payloadOnline)
+	go func() {
+		if token.WaitTimeout(time.Minute) && token.Error() != nil {
+			p.logger().Warnf("Failed to publish the exporter availability: %v", token.Error())
+		}
+	}()
+}
+
+// Name implements push.Sink.
+func (p *Publisher) Name() string {
+	return sinkName
+}
+
+// Push implements push.Sink, publishing the state of each target at its last
+// collection. The metric families are not used.
+func (p *Publisher) Push(ctx context.Context, _ []*dto.MetricFamily, timestamp time.Time) error {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	// The first push, such as the only one in once mode, waits for the
+	// connection.
+	select {
+	case <-p.connected.Done():
+	case <-ctx.Done():
+	}
+	if !p.client.IsConnectionOpen() {
+		metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+		return fmt.Errorf("not connected to the MQTT broker")
+	}
+
+	var tokens []paho.Token
+	publish := func(topic string, retained bool, payload any) {
+		tokens = append(tokens, p.client.Publish(topic, qos, retained, payload))
+	}
+
+	for _, target := range p.targets() {
+		hostname := target.GetHostname()
+		state := target.LastScrape()
+		availability := payloadOffline
+		if state.Status != nil && state.Status.Err == nil {
+			availability = payloadOnline
+		}
+
+		snapshot := target.Snapshot()
+		if snapshot != nil {
+			if p.discoveryPrefix != "" && p.markDiscovered(hostname) {
+				for _, s := range sensors {
+					config, err := json.Marshal(p.discoveryConfig(hostname, snapshot, s))
+					if err != nil {
+						return fmt.Errorf("failed to encode discovery config: %w", err)
+					}
+					publish(p.discoveryTopic(hostname, s), true, config)
+				}
+			}
+			for _, s := range sensors {
+				if value, known := s.value(snapshot, timestamp); known {
+					publish(p.valueTopic(hostname, s.key), true, value)
+				}
+			}
+		}
+		publish(p.availabilityTopic(hostname), true, availability)
+	}
+
+	var errs []error
+	for _, token := range tokens {
+		select {
+		case <-token.Done():
+			if err := token.Error(); err != nil {
+				errs = append(errs, err)
+			}
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		// The discovery configs are published again on the next push.
+		p.mu.Lock()
+		p.discovered = make(map[string]bool)
+		p.mu.Unlock()
+		metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+		return fmt.Errorf("failed to publish to the MQTT broker: %w", errors.Join(errs...))
+	}
+	metrics.PushBatches.WithLabelValues(sinkName, "success").Inc()
+	return nil
+}
+
+// markDiscovered records that the discovery configs of hostname are
+// published, returning false when they already were.
+func (p *Publisher) markDiscovered(hostname string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered[hostname] {
+		return false
+	}
+	p.discovered[hostname] = true
+	return true
+}
+
+// Close marks the exporter offline and disconnects from the broker.
+func (p *Publisher) Close() error {
+	if p.client.IsConnectionOpen() {
+		token := p.client.Publish(p.statusTopic(), qos, true, payloadOffline)
+		if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+			p.logger().Warnf("Failed to publish the exporter availability: %v", token.Error())
+		}
+	}
+	p.client.Disconnect(250)
+	return nil
+}
+
+func (p *Publisher) logger() *log.Entry {
+	return log.WithField("sink", sinkName)
+}
+
+func (p *Publisher) statusTopic() string {
+	return p.topicPrefix + "/status"
+}
+
+func (p *Publisher) availabilityTopic(hostname string) string {
+	return p.topicPrefix + "/" + hostname + "/availability"
+}
+
+func (p *Publisher) valueTopic(hostname, key string) string {
+	return p.topicPrefix + "/" + hostname + "/" + key
+}
+
+func (p *Publisher) discoveryTopic(hostname string, s sensor) string {
+	return fmt.Sprintf("%s/sensor/pihole_exporter/%s_%s/config", p.discoveryPrefix, objectID(hostname), s.key)
+}
+
+// sensor is a value published for each target, and its Home Assistant entity.
+type sensor struct {
+	key         string
+	name        string
+	icon        string
+	unit        string
+	deviceClass string
+	stateClass  string
+	options     []string
+	// value returns the value of the sensor, which is not published when
+	// unknown.
+	value func(snapshot *pihole.Snapshot, now time.Time) (string, bool)
+}
+
+var sensors = []sensor{
+	{
+		key: "queries_today", name: "Queries today", icon: "mdi:dns", unit: "queries", stateClass: "total_increasing",
+		value: func(s *pihole.Snapshot, _ time.Time) (string, bool) {
+			return strconv.Itoa(s.Summary.QueriesTotal), true
+		},
+	},
+	{
+		key: "blocked_today", name: "Blocked today", icon: "mdi:block-helper", unit: "queries", stateClass: "total_increasing",
+		value: func(s *pihole.Snapshot, _ time.Time) (string, bool) {
+			return strconv.Itoa(s.Summary.QueriesBlocked), true
+		},
+	},
+	{
+		key: "percent_blocked", name: "Percent blocked", icon: "mdi:percent", unit: "%", stateClass: "measurement",
+		value: func(s *pihole.Snapshot, _ time.Time) (string, bool) {
+			return strconv.FormatFloat(s.Summary.PercentBlocked, 'f', 2, 64), true
+		},
+	},
+	{
+		key: "status", name: "Blocking status", icon: "mdi:pi-hole", deviceClass: "enum", options: pihole.BlockingStates,
+		value: func(s *pihole.Snapshot, _ time.Time) (string, bool) { return s.Blocking.State, true },
+	},
+	{
+		key: "gravity_age", name: "Gravity age", icon: "mdi:update", unit: "s", deviceClass: "duration", stateClass: "measurement",
+		value: func(s *pihole.Snapshot, now time.Time) (string, bool) {
+			if s.Summary.GravityUpdatedAt == nil {
+				return "", false
+			}
+			return strconv.FormatInt(int64(now.Sub(*s.Summary.GravityUpdatedAt).Seconds()), 10), true
+		},
+	},
+}
+
+// discoveryConfig is the Home Assistant MQTT discovery config of a sensor.
+type discoveryConfig struct {
+	Name              string         `json:"name"`
+	UniqueID          string         `json:"unique_id"`
+	StateTopic        string         `json:"state_topic"`
+	Availability      []availability `json:"availability"`
+	AvailabilityMode  string         `json:"availability_mode"`
+	Icon              string         `json:"icon,omitempty"`
+	UnitOfMeasurement string         `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string         `json:"device_class,omitempty"`
+	StateClass        string         `json:"state_class,omitempty"`
+	Options           []string       `json:"options,omitempty"`
+	Device            device         `json:"device"`
+}
+
+type availability struct {
+	Topic string `json:"topic"`
+}
+
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+func (p *Publisher) discoveryConfig(hostname string, snapshot *pihole.Snapshot, s sensor) discoveryConfig {
+	config := discoveryConfig{
+		Name:              s.name,
+		UniqueID:          "pihole_exporter_" + objectID(hostname) + "_" + s.key,
+		StateTopic:        p.valueTopic(hostname, s.key),
+		Availability:      []availability{{Topic: p.statusTopic()}, {Topic: p.availabilityTopic(hostname)}},
+		AvailabilityMode:  "all",
+		Icon:              s.icon,
+		UnitOfMeasurement: s.unit,
+		DeviceClass:       s.deviceClass,
+		StateClass:        s.stateClass,
+		Options:           s.options,
+		Device: device{
+			Identifiers:  []string{"pihole_exporter_" + objectID(hostname)},
+			Name:         "Pi-hole " + hostname,
+			Manufacturer: "Pi-hole",
+			Model:        "Pi-hole",
+		},
+	}
+	if snapshot.Versions != nil {
+		config.Device.SWVersion = snapshot.Versions.Core
+	}
+	return config
+}
+
+var invalidObjectIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// objectID returns the Home Assistant object ID of a target, which only
+// allows letters, digits, underscores and hyphens.
+func objectID(hostname string) string {
+	return invalidObjectIDChars.ReplaceAllString(hostname, "_")
+}
@@ -0,0 +1,189 @@
+package mqtt_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/mqtt"
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+// broker is an in-process MQTT broker recording the last message of each topic.
+type broker struct {
+	server *mochi.Server
+	url    string
+
+	mu       sync.Mutex
+	messages map[string]string
+}
+
+func newBroker(t *testing.T) *broker {
+	t.Helper()
+	server := mochi.New(&mochi.Options{InlineClient: true, Logger: slog.New(slog.DiscardHandler)})
+	require.NoError(t, server.AddHook(new(auth.Hook), &auth.Options{Ledger: &auth.Ledger{
+		Auth: auth.AuthRules{{Username: "exporter", Password: "secret", Allow: true}},
+	}}))
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	require.NoError(t, server.AddListener(tcp))
+	require.NoError(t, server.Serve())
+	t.Cleanup(func() { _ = server.Close() })
+
+	b := &broker{server: server, url: "tcp://" + tcp.Address(), messages: make(map[string]string)}
+	require.NoError(t, server.Subscribe("#", 1, func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.messages[pk.TopicName] = string(pk.Payload)
+	}))
+	return b
+}
+
+func (b *broker) message(topic string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.messages[topic]
+}
+
+// newTarget returns a Pi-hole client collected once from a fake API serving
+// summary.
+func newTarget(t *testing.T, summary map[string]any) *pihole.Client {
+	t.Helper()
+	stub := piholetest.NewServer(t, map[string]any{
+		"/api/stats/summary":   summary,
+		"/api/stats/upstreams": map[string]any{},
+		"/api/dns/blocking":    map[string]any{"blocking": "enabled"},
+		"/api/info/version":    map[string]any{"version": map[string]any{"core": map[string]any{"local": map[string]any{"version": "v6.1"}}}},
+	})
+	client := piholetest.NewClient(t, stub, "127.0.0.1", &config.EnvConfig{Timeout: time.Second})
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	return client
+}
+
+func newOptions(b *broker) mqtt.Options {
+	return mqtt.Options{
+		URL:             b.url,
+		Username:        "exporter",
+		Password:        "secret",
+		ClientID:        "pihole-exporter",
+		TopicPrefix:     "pihole-exporter",
+		DiscoveryPrefix: "homeassistant",
+		Timeout:         time.Second,
+	}
+}
+
+// TestPublisher tests that the values, availability and discovery configs are published
+func TestPublisher(t *testing.T) {
+	b := newBroker(t)
+	target := newTarget(t, map[string]any{
+		"queries": map[string]any{"total": 1000, "blocked": 150, "percent_blocked": 15.0},
+		"gravity": map[string]any{"last_update": time.Now().Add(-time.Hour).Unix()},
+	})
+	publisher, err := mqtt.NewPublisher(newOptions(b), func() []*pihole.Client { return []*pihole.Client{target} })
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Push(context.Background(), nil, time.Now()))
+	require.Eventually(t, func() bool { return b.message("pihole-exporter/127.0.0.1/availability") == "online" }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "online", b.message("pihole-exporter/status"))
+	assert.Equal(t, "1000", b.message("pihole-exporter/127.0.0.1/queries_today"))
+	assert.Equal(t, "150", b.message("pihole-exporter/127.0.0.1/blocked_today"))
+	assert.Equal(t, "15.00", b.message("pihole-exporter/127.0.0.1/percent_blocked"))
+	assert.Equal(t, "enabled", b.message("pihole-exporter/127.0.0.1/status"))
+	gravityAge, err := strconv.Atoi(b.message("pihole-exporter/127.0.0.1/gravity_age"))
+	require.NoError(t, err)
+	assert.InDelta(t, 3600, gravityAge, 60)
+
+	var discovery map[string]any
+	require.NoError(t, json.Unmarshal([]byte(b.message("homeassistant/sensor/pihole_exporter/127_0_0_1_queries_today/config")), &discovery))
+	assert.Equal(t, "pihole_exporter_127_0_0_1_queries_today", discovery["unique_id"])
+	assert.Equal(t, "pihole-exporter/127.0.0.1/queries_today", discovery["state_topic"])
+	assert.Equal(t, "total_increasing", discovery["state_class"])
+	assert.Equal(t, []any{
+		map[string]any{"topic": "pihole-exporter/status"},
+		map[string]any{"topic": "pihole-exporter/127.0.0.1/availability"},
+	}, discovery["availability"])
+	assert.Equal(t, "v6.1", discovery["device"].(map[string]any)["sw_version"])
+
+	// The broker marks the exporter offline when the connection is lost.
+	client, found := b.server.Clients.Get("pihole-exporter")
+	require.True(t, found)
+	assert.Equal(t, "pihole-exporter/status", client.Properties.Will.TopicName)
+	assert.Equal(t, "offline", string(client.Properties.Will.Payload))
+	assert.True(t, client.Properties.Will.Retain)
+
+	require.NoError(t, publisher.Close())
+	require.Eventually(t, func() bool { return b.message("pihole-exporter/status") == "offline" }, 5*time.Second, time.Millisecond)
+}
+
+// TestPublisher_UnknownGravityAge tests that the gravity age is not published
+// before Pi-hole reports a gravity update
+func TestPublisher_UnknownGravityAge(t *testing.T) {
+	b := newBroker(t)
+	target := newTarget(t, map[string]any{"queries": map[string]any{"total": 1000}})
+	publisher, err := mqtt.NewPublisher(newOptions(b), func() []*pihole.Client { return []*pihole.Client{target} })
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	require.NoError(t, publisher.Push(context.Background(), nil, time.Now()))
+	require.Eventually(t, func() bool { return b.message("pihole-exporter/127.0.0.1/availability") == "online" }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "1000", b.message("pihole-exporter/127.0.0.1/queries_today"))
+	b.mu.Lock()
+	_, published := b.messages["pihole-exporter/127.0.0.1/gravity_age"]
+	b.mu.Unlock()
+	assert.False(t, published)
+}
+
+// TestPublisher_Unauthorized tests that a push fails when the broker rejects the credentials
+func TestPublisher_Unauthorized(t *testing.T) {
+	b := newBroker(t)
+	opts := newOptions(b)
+	opts.Password = "wrong"
+	publisher, err := mqtt.NewPublisher(opts, func() []*pihole.Client { return nil })
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Error(t, publisher.Push(ctx, nil, time.Now()))
+}
+
+// TestPublisher_BrokerDown tests that a push gives up after the timeout when the broker is down
+func TestPublisher_BrokerDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	opts := mqtt.Options{URL: "tcp://" + listener.Addr().String(), ClientID: "pihole-exporter", Timeout: 100 * time.Millisecond}
+	require.NoError(t, listener.Close())
+
+	publisher, err := mqtt.NewPublisher(opts, func() []*pihole.Client { return nil })
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- publisher.Push(context.Background(), nil, time.Now()) }()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the push did not give up after the timeout")
+	}
+}
+
+// TestPublisher_TLS tests that an invalid CA file is rejected
+func TestPublisher_TLS(t *testing.T) {
+	opts := mqtt.Options{URL: "ssl://127.0.0.1:8883", CAFile: "testdata/missing.pem"}
+	_, err := mqtt.NewPublisher(opts, func() []*pihole.Client { return nil })
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/tracing"
+)
+
+// hostnameLabel is the label of the Pi-hole metrics holding the target.
+const hostnameLabel = "hostname"
+
+// Exporter pushes the metrics to an OpenTelemetry Collector over OTLP. The
+// metrics of each Pi-hole target are sent under their own resource, with the
+// target as host.name, so that they look like the metrics of the device
+// itself.
+type Exporter struct {
+	exporter  sdkmetric.Exporter
+	resource  *resource.Resource
+	scope     instrumentation.Scope
+	startTime time.Time
+	timeout   time.Duration
+}
+
+// NewExporter returns an Exporter to endpoint, an URL such as
+// http://collector:4318/v1/metrics with the http/protobuf protocol or
+// http://collector:4317 with grpc. The standard OTEL_EXPORTER_OTLP_* and
+// OTEL_RESOURCE_ATTRIBUTES environment variables are honored.
+func NewExporter(ctx context.Context, endpoint, protocol string, timeout time.Duration) (*Exporter, error) {
+	var exporter sdkmetric.Exporter
+	var err error
+	switch protocol {
+	case config.OTLPProtocolGRPC:
+		exporter, err = otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(endpoint), otlpmetricgrpc.WithTimeout(timeout))
+	case config.OTLPProtocolHTTP:
+		exporter, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint), otlpmetrichttp.WithTimeout(timeout))
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %s", protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithAttributes(semconv.ServiceName(tracing.ServiceName), semconv.ServiceVersion(version.Version)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric resource: %w", err)
+	}
+
+	return &Exporter{
+		exporter:  exporter,
+		resource:  res,
+		scope:     instrumentation.Scope{Name: "github.com/eko/pihole-exporter", Version: version.Version},
+		startTime: time.Now(),
+		timeout:   timeout,
+	}, nil
+}
+
+// Name implements push.Sink.
+func (e *Exporter) Name() string {
+	return "otlp"
+}
+
+// Push implements push.Sink, with an export request per Pi-hole target. The
+// failed requests are retried by the OTLP exporter.
+func (e *Exporter) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	byHostname := Convert(families, e.startTime, timestamp)
+
+	hostnames := make([]string, 0, len(byHostname))
+	for hostname := range byHostname {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	var errs []error
+	for _, hostname := range hostnames {
+		res := e.resource
+		if hostname != "" {
+			var err error
+			res, err = resource.Merge(e.resource, resource.NewSchemaless(semconv.HostName(hostname)))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to create resource of %s: %w", hostname, err))
+				continue
+			}
+		}
+
+		err := e.exporter.Export(ctx, &metricdata.ResourceMetrics{
+			Resource:     res,
+			ScopeMetrics: []metricdata.ScopeMetrics{{Scope: e.scope, Metrics: byHostname[hostname]}},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to export metrics of %s: %w", hostname, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close flushes and closes the connection to the collector.
+func (e *Exporter) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	return e.exporter.Shutdown(ctx)
+}
+
+// Convert converts the metric families into OpenTelemetry metrics, grouped by
+// the hostname label of their series, which is removed from their attributes.
+// The series without hostname are grouped under the empty hostname. Counters
+// become cumulative monotonic sums started at startTime.
+func Convert(families []*dto.MetricFamily, startTime, timestamp time.Time) map[string][]metricdata.Metrics {
+	result := make(map[string][]metricdata.Metrics)
+	for _, family := range families {
+		byHostname := make(map[string][]*dto.Metric)
+		var hostnames []string
+		for _, m := range family.GetMetric() {
+			hostname := labelValue(m, hostnameLabel)
+			if _, found := byHostname[hostname]; !found {
+				hostnames = append(hostnames, hostname)
+			}
+			byHostname[hostname] = append(byHostname[hostname], m)
+		}
+
+		for _, hostname := range hostnames {
+			result[hostname] = append(result[hostname], metricdata.Metrics{
+				Name:        family.GetName(),
+				Description: family.GetHelp(),
+				Data:        convertData(family.GetType(), byHostname[hostname], startTime, timestamp),
+			})
+		}
+	}
+	return result
+}
+
+func convertData(metricType dto.MetricType, ms []*dto.Metric, startTime, timestamp time.Time) metricdata.Aggregation {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		points := make([]metricdata.DataPoint[float64], 0, len(ms))
+		for _, m := range ms {
+			points = append(points, metricdata.DataPoint[float64]{Attributes: attributes(m), StartTime: startTime, Time: timestamp, Value: m.GetCounter().GetValue()})
+		}
+		return metricdata.Sum[float64]{DataPoints: points, Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+
+	case dto.MetricType_HISTOGRAM:
+		points := make([]metricdata.HistogramDataPoint[float64], 0, len(ms))
+		for _, m := range ms {
+			h := m.GetHistogram()
+			point := metricdata.HistogramDataPoint[float64]{
+				Attributes: attributes(m),
+				StartTime:  startTime,
+				Time:       timestamp,
+				Count:      h.GetSampleCount(),
+				Sum:        h.GetSampleSum(),
+			}
+			// Prometheus buckets are cumulative, OTLP ones are not and end
+			// with the implicit +Inf bucket.
+			var previous uint64
+			for _, b := range h.GetBucket() {
+				if math.IsInf(b.GetUpperBound(), 1) {
+					break
+				}
+				point.Bounds = append(point.Bounds, b.GetUpperBound())
+				point.BucketCounts = append(point.BucketCounts, b.GetCumulativeCount()-previous)
+				previous = b.GetCumulativeCount()
+			}
+			point.BucketCounts = append(point.BucketCounts, h.GetSampleCount()-previous)
+			points = append(points, point)
+		}
+		return metricdata.Histogram[float64]{DataPoints: points, Temporality: metricdata.CumulativeTemporality}
+
+	case dto.MetricType_SUMMARY:
+		points := make([]metricdata.SummaryDataPoint, 0, len(ms))
+		for _, m := range ms {
+			s := m.GetSummary()
+			point := metricdata.SummaryDataPoint{
+				Attributes: attributes(m),
+				StartTime:  startTime,
+				Time:       timestamp,
+				Count:      s.GetSampleCount(),
+				Sum:        s.GetSampleSum(),
+			}
+			for _, q := range s.GetQuantile() {
+				point.QuantileValues = append(point.QuantileValues, metricdata.QuantileValue{Quantile: q.GetQuantile(), Value: q.GetValue()})
+			}
+			points = append(points, point)
+		}
+		return metricdata.Summary{DataPoints: points}
+
+	default:
+		// Gauges and untyped metrics.
+		points := make([]metricdata.DataPoint[float64], 0, len(ms))
+		for _, m := range ms {
+			value := m.GetGauge().GetValue()
+			if metricType == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			points = append(points, metricdata.DataPoint[float64]{Attributes: attributes(m), Time: timestamp, Value: value})
+		}
+		return metricdata.Gauge[float64]{DataPoints: points}
+	}
+}
+
+// attributes returns the labels of a series but the hostname.
+func attributes(m *dto.Metric) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(m.GetLabel()))
+	for _, label := range m.GetLabel() {
+		if label.GetName() != hostnameLabel {
+			kvs = append(kvs, attribute.String(label.GetName(), label.GetValue()))
+		}
+	}
+	return attribute.NewSet(kvs...)
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package otlp_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/otlp"
+)
+
+// receiver is a fake OTLP receiver recording the exported resource metrics,
+// over HTTP and gRPC.
+type receiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	received []*metricspb.ResourceMetrics
+}
+
+func (r *receiver) Export(_ context.Context, request *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, request.GetResourceMetrics()...)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	request := &collectormetrics.ExportMetricsServiceRequest{}
+	if err == nil {
+		err = proto.Unmarshal(body, request)
+	}
+	if err != nil || req.URL.Path != "/v1/metrics" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	_, _ = r.Export(req.Context(), request)
+
+	response, _ := proto.Marshal(&collectormetrics.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(response)
+}
+
+// byHost returns the metrics received for each host.name resource attribute.
+func (r *receiver) byHost() map[string][]*metricspb.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make(map[string][]*metricspb.Metric)
+	for _, rm := range r.received {
+		var host string
+		for _, attr := range rm.GetResource().GetAttributes() {
+			if attr.GetKey() == "host.name" {
+				host = attr.GetValue().GetStringValue()
+			}
+		}
+		for _, sm := range rm.GetScopeMetrics() {
+			result[host] = append(result[host], sm.GetMetrics()...)
+		}
+	}
+	return result
+}
+
+func gather(t *testing.T) []*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	status := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_status", Help: "status"}, []string{"hostname"})
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "pihole_requests_total"}, []string{"hostname", "code"})
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "pihole_duration_seconds", Buckets: []float64{0.1, 1}})
+	registry.MustRegister(status, requests, duration)
+	status.WithLabelValues("pihole1").Set(1)
+	status.WithLabelValues("pihole2").Set(0)
+	requests.WithLabelValues("pihole1", "200").Add(3)
+	duration.Observe(0.5)
+	duration.Observe(2)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	return families
+}
+
+func assertExported(t *testing.T, r *receiver) {
+	t.Helper()
+	byHost := r.byHost()
+	require.Len(t, byHost, 3)
+
+	pihole1 := byHost["pihole1"]
+	require.Len(t, pihole1, 2)
+	assert.Equal(t, "pihole_requests_total", pihole1[0].GetName())
+	sum := pihole1[0].GetSum()
+	assert.True(t, sum.GetIsMonotonic())
+	assert.Equal(t, 3.0, sum.GetDataPoints()[0].GetAsDouble())
+	require.Len(t, sum.GetDataPoints()[0].GetAttributes(), 1, "the hostname label must not be an attribute")
+	assert.Equal(t, "code", sum.GetDataPoints()[0].GetAttributes()[0].GetKey())
+	assert.Equal(t, "pihole_status", pihole1[1].GetName())
+	assert.Equal(t, "status", pihole1[1].GetDescription())
+	assert.Equal(t, 1.0, pihole1[1].GetGauge().GetDataPoints()[0].GetAsDouble())
+
+	require.Len(t, byHost["pihole2"], 1)
+	assert.Equal(t, 0.0, byHost["pihole2"][0].GetGauge().GetDataPoints()[0].GetAsDouble())
+
+	// The series without hostname are exported under the exporter resource.
+	require.Len(t, byHost[""], 1)
+	histogram := byHost[""][0].GetHistogram().GetDataPoints()[0]
+	assert.Equal(t, []float64{0.1, 1}, histogram.GetExplicitBounds())
+	assert.Equal(t, []uint64{0, 1, 1}, histogram.GetBucketCounts())
+	assert.Equal(t, uint64(2), histogram.GetCount())
+}
+
+// TestExporter_HTTP tests the export of the metrics over OTLP/HTTP, a resource per target
+func TestExporter_HTTP(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	exporter, err := otlp.NewExporter(context.Background(), server.URL+"/v1/metrics", config.OTLPProtocolHTTP, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, exporter.Push(context.Background(), gather(t), time.Now()))
+	require.NoError(t, exporter.Close())
+
+	assertExported(t, r)
+}
+
+// TestExporter_GRPC tests the export of the metrics over OTLP/gRPC, a resource per target
+func TestExporter_GRPC(t *testing.T) {
+	r := &receiver{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(server, r)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	exporter, err := otlp.NewExporter(context.Background(), "http://"+listener.Addr().String(), config.OTLPProtocolGRPC, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, exporter.Push(context.Background(), gather(t), time.Now()))
+	require.NoError(t, exporter.Close())
+
+	assertExported(t, r)
+}
@@ -7,17 +7,29 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"crypto/tls"
 
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/tracing"
 )
 
 type APIClient struct {
 	BaseURL   string
 	Client    *http.Client
+	logger    *log.Entry
+	hostname  string
 	password  string
 	sessionID string
 	validity  time.Time
@@ -44,8 +56,15 @@ func NewAPIClient(baseURL string, password string, timeout time.Duration, skipTL
 		},
 	}
 
+	hostname := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		hostname = u.Hostname()
+	}
+
 	return &APIClient{
 		BaseURL:  baseURL,
+		logger:   log.WithField("hostname", hostname),
+		hostname: hostname,
 		password: password,
 		Client: &http.Client{
 			Timeout:   timeout,
@@ -55,56 +74,73 @@ func NewAPIClient(baseURL string, password string, timeout time.Duration, skipTL
 }
 
 // Authenticate logs in and stores the session ID.
-func (c *APIClient) Authenticate() error {
+func (c *APIClient) Authenticate(ctx context.Context) (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	url := fmt.Sprintf("%s/api/auth", c.BaseURL)
+	ctx, span := c.startSpan(ctx, http.MethodPost, "/api/auth")
+	defer func() { endSpan(span, err) }()
+
 	payload := map[string]string{"password": c.password}
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal authentication payload: %w", err)
 	}
 
-	log.Debugf("Authenticating to %s", c.BaseURL)
+	logger := c.logger.WithField("endpoint", "/api/auth")
+	logger.Debug("Authenticating")
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/auth", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to create authentication request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.Client.Post(url, "application/json", bytes.NewBuffer(jsonPayload))
+	resp, err := c.Client.Do(req)
+	c.observeRequest(ctx, http.MethodPost, "/api/auth", resp, err, time.Since(start))
 	if err != nil {
-		log.Errorf("Authentication request failed: %v", err)
+		metrics.AuthAttempts.WithLabelValues(c.hostname, "error").Inc()
+		logger.WithField("duration", time.Since(start).String()).Errorf("Authentication request failed: %v", err)
 		return fmt.Errorf("authentication request failed: %w", err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Warnf("Failed to close response body: %v", err)
-		}
-	}()
+	defer c.closeBody(resp)
 
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	logger = logger.WithFields(log.Fields{"status_code": resp.StatusCode, "duration": time.Since(start).String()})
 	if resp.StatusCode != http.StatusOK {
+		metrics.AuthAttempts.WithLabelValues(c.hostname, "failure").Inc()
+		logger.Debug("Authentication refused")
 		return fmt.Errorf("authentication failed, status code: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize)) // Prevent
 	if err != nil {
+		metrics.AuthAttempts.WithLabelValues(c.hostname, "error").Inc()
 		return fmt.Errorf("failed to read authentication response: %w", err)
 	}
+	span.SetAttributes(semconv.HTTPResponseBodySize(len(body)))
 
 	var authResp authResponse
 	if err := json.Unmarshal(body, &authResp); err != nil {
+		metrics.AuthAttempts.WithLabelValues(c.hostname, "error").Inc()
 		return fmt.Errorf("failed to parse authentication response: %w", err)
 	}
 
 	if !authResp.Session.Valid {
+		metrics.AuthAttempts.WithLabelValues(c.hostname, "failure").Inc()
 		return fmt.Errorf("authentication unsuccessful")
 	}
+	metrics.AuthAttempts.WithLabelValues(c.hostname, "success").Inc()
 
 	c.sessionID = authResp.Session.SID
 	c.validity = time.Now().Add(time.Duration(authResp.Session.Validity) * time.Second)
-	log.Debugf("Authentication successful")
+	logger.Debug("Authentication successful")
 	return nil
 }
 
 // ensureAuth ensures the session is valid before making a request.
-func (c *APIClient) ensureAuth() error {
+func (c *APIClient) ensureAuth(ctx context.Context) error {
 	c.mu.Lock()
 	// Check if authentication is needed
 	needsAuth := time.Now().After(c.validity)
@@ -114,45 +150,50 @@ func (c *APIClient) ensureAuth() error {
 	// NOTE! Authenticate() already acquires c.mu internally.
 	// introducing locking here (even RWMutex) would cause a deadlock.
 	if needsAuth {
-		log.Debug("Session expired, re-authenticating")
-		return c.Authenticate()
+		c.logger.Debug("Session expired, re-authenticating")
+		return c.Authenticate(ctx)
 	}
 	return nil
 }
 
-// FetchData makes a GET request to the specified endpoint and parses the response.
-func (c *APIClient) FetchData(endpoint string, result interface{}) error {
-	if err := c.ensureAuth(); err != nil {
+// FetchData makes a GET request to the specified endpoint and parses the
+// response. The request is aborted when ctx is cancelled.
+func (c *APIClient) FetchData(ctx context.Context, endpoint string, result interface{}) (err error) {
+	if err := c.ensureAuth(ctx); err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("%s%s", c.BaseURL, endpoint)
-	log.Debugf("Fetching data from %s", url)
+	ctx, span := c.startSpan(ctx, http.MethodGet, endpoint)
+	defer func() { endSpan(span, err) }()
+
+	endpointURL := fmt.Sprintf("%s%s", c.BaseURL, endpoint)
+	logger := c.logger.WithField("endpoint", endpoint)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, c.Client.Timeout)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpointURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add security headers
-	req.Header.Set("X-FTL-SID", c.sessionID)
+	req.Header.Set("X-FTL-SID", c.session())
 	req.Header.Set("X-Content-Type-Options", "nosniff")
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.Client.Timeout)
-	defer cancel()
-	req = req.WithContext(ctx)
-
 	resp, err := c.Client.Do(req)
+	c.observeRequest(ctx, http.MethodGet, endpoint, resp, err, time.Since(start))
 	if err != nil {
-		return fmt.Errorf("failed to fetch data from %s: %w", url, err)
+		logger.WithField("duration", time.Since(start).String()).Debugf("Request failed: %v", err)
+		return fmt.Errorf("failed to fetch data from %s: %w", endpointURL, err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Warnf("Failed to close response body: %v", err)
-		}
-	}()
+	defer c.closeBody(resp)
 
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	logger = logger.WithFields(log.Fields{"status_code": resp.StatusCode, "duration": time.Since(start).String()})
 	if resp.StatusCode != http.StatusOK {
+		logger.Debug("Unexpected status code")
 		return fmt.Errorf("non-200 status code: %d", resp.StatusCode)
 	}
 
@@ -160,15 +201,129 @@ func (c *APIClient) FetchData(endpoint string, result interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to read response body: %w", err)
 	}
+	span.SetAttributes(semconv.HTTPResponseBodySize(len(body)))
 
 	if err := json.Unmarshal(body, result); err != nil {
 		return fmt.Errorf("failed to parse JSON response: %w", err)
 	}
 
-	log.Debugf("Successfully fetched data from endpoint: %s", endpoint)
+	logger.Debug("Successfully fetched data")
+	return nil
+}
+
+// session returns the current session ID.
+func (c *APIClient) session() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// SetPassword changes the password used to authenticate, the next request
+// opens a new session.
+func (c *APIClient) SetPassword(password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.password = password
+	c.sessionID = ""
+	c.validity = time.Time{}
+}
+
+// Logout closes the current session, if any, so that it does not count
+// against the maximum number of sessions allowed by the Pi-hole API.
+func (c *APIClient) Logout() error {
+	c.mu.Lock()
+	sessionID := c.sessionID
+	valid := time.Now().Before(c.validity)
+	c.sessionID = ""
+	c.validity = time.Time{}
+	c.mu.Unlock()
+
+	if sessionID == "" || !valid {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/auth", c.BaseURL), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create logout request: %w", err)
+	}
+	req.Header.Set("X-FTL-SID", sessionID)
+
+	start := time.Now()
+	resp, err := c.Client.Do(req)
+	c.observeRequest(context.Background(), http.MethodDelete, "/api/auth", resp, err, time.Since(start))
+	if err != nil {
+		return fmt.Errorf("logout request failed: %w", err)
+	}
+	defer c.closeBody(resp)
+
+	c.logger.WithFields(log.Fields{"endpoint": "/api/auth", "status_code": resp.StatusCode, "duration": time.Since(start).String()}).Debug("Logged out")
+
+	// The session may have expired on the Pi-hole side in the meantime.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("logout failed, status code: %d", resp.StatusCode)
+	}
 	return nil
 }
 
+// SessionValidity returns the time until which the current session is valid,
+// the zero time when no session was opened yet.
+func (c *APIClient) SessionValidity() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.validity
+}
+
+// startSpan starts the span of a request to the endpoint of the Pi-hole API.
+func (c *APIClient) startSpan(ctx context.Context, method, endpoint string) (context.Context, trace.Span) {
+	path, _, _ := strings.Cut(endpoint, "?")
+	return tracing.Tracer().Start(ctx, method+" "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLFull(c.BaseURL+endpoint),
+		),
+	)
+}
+
+// observeRequest records a request to the endpoint of the Pi-hole API in the
+// exporter metrics, the query string being left out of the endpoint. The
+// duration is linked to the trace of the request, when sampled, by an
+// exemplar.
+func (c *APIClient) observeRequest(ctx context.Context, method, endpoint string, resp *http.Response, err error, duration time.Duration) {
+	path, _, _ := strings.Cut(endpoint, "?")
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.FTLRequests.WithLabelValues(c.hostname, method, path, code).Inc()
+
+	observer := metrics.FTLRequestDuration.WithLabelValues(c.hostname, method, path)
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsSampled() {
+		observer.Observe(duration.Seconds())
+		return
+	}
+	observer.(prometheus.ExemplarObserver).ObserveWithExemplar(duration.Seconds(), prometheus.Labels{
+		"trace_id": spanContext.TraceID().String(),
+		"span_id":  spanContext.SpanID().String(),
+	})
+}
+
+// endSpan records the error of a request, if any, and ends its span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *APIClient) closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		c.logger.Warnf("Failed to close response body: %v", err)
+	}
+}
+
 // Close cleans up resources used by the API client
 func (c *APIClient) Close() {
 	// Close the transport to ensure no connection leaks
@@ -1,10 +1,17 @@
 package pihole_test
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
 	"github.com/eko/pihole-exporter/internal/pihole"
 )
 
@@ -41,3 +48,67 @@ func TestNewAPIClient_TLSVerification(t *testing.T) {
 		})
 	}
 }
+
+// TestFetchData_LogFields tests that the requests to Pi-hole are logged with consistent fields
+func TestFetchData_LogFields(t *testing.T) {
+	hook := logtest.NewGlobal()
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	t.Cleanup(func() {
+		log.SetLevel(level)
+		log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	})
+
+	stub := httptest.NewServer(&authRecorder{})
+	defer stub.Close()
+
+	c := pihole.NewAPIClient(stub.URL, "secret", time.Second, false)
+	var recentBlocked pihole.RecentBlocked
+	if err := c.FetchData(context.Background(), "/api/stats/recent_blocked", &recentBlocked); err != nil {
+		t.Fatalf("FetchData() error = %v", err)
+	}
+
+	var fetched *log.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["endpoint"] == "/api/stats/recent_blocked" && entry.Data["status_code"] != nil {
+			fetched = entry
+		}
+	}
+	if fetched == nil {
+		t.Fatalf("no log entry of the request, got %v", hook.AllEntries())
+	}
+	if fetched.Data["hostname"] != "127.0.0.1" {
+		t.Errorf("hostname = %v, want 127.0.0.1", fetched.Data["hostname"])
+	}
+	if fetched.Data["status_code"] != http.StatusOK {
+		t.Errorf("status_code = %v, want %d", fetched.Data["status_code"], http.StatusOK)
+	}
+	if _, ok := fetched.Data["duration"]; !ok {
+		t.Errorf("missing duration field")
+	}
+}
+
+// TestFetchData_Metrics tests that the requests to Pi-hole and the authentications are counted
+func TestFetchData_Metrics(t *testing.T) {
+	stub := httptest.NewServer(&authRecorder{})
+	defer stub.Close()
+
+	requests := metrics.FTLRequests.WithLabelValues("127.0.0.1", http.MethodGet, "/api/stats/recent_blocked", "200")
+	auths := metrics.AuthAttempts.WithLabelValues("127.0.0.1", "success")
+	requestsBefore, authsBefore := testutil.ToFloat64(requests), testutil.ToFloat64(auths)
+
+	c := pihole.NewAPIClient(stub.URL, "secret", time.Second, false)
+	var recentBlocked pihole.RecentBlocked
+	for range 2 {
+		if err := c.FetchData(context.Background(), "/api/stats/recent_blocked", &recentBlocked); err != nil {
+			t.Fatalf("FetchData() error = %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(requests) - requestsBefore; got != 2 {
+		t.Errorf("requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(auths) - authsBefore; got != 1 {
+		t.Errorf("authentications = %v, want 1", got)
+	}
+}
@@ -1,13 +1,23 @@
 package pihole
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/eko/pihole-exporter/config"
 	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/tracing"
 )
 
 type ClientStatus byte
@@ -34,24 +44,64 @@ func (status ClientStatus) String() string {
 	return []string{"MetricsCollectionInProgress", "MetricsCollectionSuccess", "MetricsCollectionError", "MetricsCollectionTimeout"}[status]
 }
 
-type ClientChannel struct {
+// ErrClientClosed is returned by the requests made through a closed client.
+var ErrClientClosed = errors.New("client is closed")
+
+// CollectionResult is the result of a metrics collection.
+type CollectionResult struct {
 	Status ClientStatus
 	Err    error
 }
 
-func (c *ClientChannel) String() string {
+func (c *CollectionResult) String() string {
 	if c.Err != nil {
-		return fmt.Sprintf("ClientChannel<Status: %s, Err: '%s'>", c.Status, c.Err.Error())
+		return fmt.Sprintf("CollectionResult<Status: %s, Err: '%s'>", c.Status, c.Err.Error())
 	} else {
-		return fmt.Sprintf("ClientChannel<Status: %s, Err: <nil>>", c.Status)
+		return fmt.Sprintf("CollectionResult<Status: %s, Err: <nil>>", c.Status)
 	}
 }
 
+// ScrapeState describes the last metrics collection of a client.
+type ScrapeState struct {
+	// Status and Err are the result of the last collection, nil before the first one.
+	Status *CollectionResult
+	// Time is when the last collection ended and Duration how long it took.
+	Time     time.Time
+	Duration time.Duration
+	// LastError is the error of the last failed collection, even if a later one succeeded.
+	LastError     error
+	LastErrorTime time.Time
+	// Version is the Pi-hole version detected on the first successful collection.
+	Version         string
+	SessionValidity time.Time
+	// Waiting is the number of calls of Collect waiting for the collection in
+	// flight, 0 without one.
+	Waiting int
+}
+
 // Client struct is a Pi-hole client to request an instance of a Pi-hole ad blocker.
 type Client struct {
 	apiClient APIClient
-	config    *config.Config
-	Status    chan *ClientChannel
+	cfg       atomic.Pointer[config.Config]
+	envConfig *config.EnvConfig
+
+	// collection is the collection in flight, shared by the concurrent calls
+	// of Collect.
+	collection *collection
+
+	// ctx is cancelled by Close, which aborts the requests in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+	state    ScrapeState
+	version  *Version
+	snapshot *Snapshot
+	// queryCursor is the position in the query log of the reply time
+	// histograms.
+	queryCursor queryCursor
 }
 
 // NewClient method initializes a new Pi-hole client.
@@ -61,157 +111,542 @@ func NewClient(config *config.Config, envConfig *config.EnvConfig) *Client {
 		log.Fatalf("err: couldn't validate passed Config: %v", err)
 	}
 
-	log.Debugf("Creating client for host %s with protocol %s and port %d", config.PIHoleHostname, config.PIHoleProtocol, config.PIHolePort)
+	log.WithField("hostname", config.PIHoleHostname).Debugf("Creating client with protocol %s and port %d", config.PIHoleProtocol, config.PIHolePort)
 
-	return &Client{
-		config:    config,
+	client := &Client{
 		apiClient: *NewAPIClient(fmt.Sprintf("%s://%s:%d", config.PIHoleProtocol, config.PIHoleHostname, config.PIHolePort), config.PIHolePassword, envConfig.Timeout, envConfig.SkipTLSVerification),
-		Status:    make(chan *ClientChannel, 1),
+		envConfig: envConfig,
 	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client.cfg.Store(config)
+	return client
+}
+
+// config returns the current configuration of the client.
+func (c *Client) config() *config.Config {
+	return c.cfg.Load()
+}
+
+// UpdateConfig replaces the configuration of the client, which must target the
+// same Pi-hole instance. A changed password closes the current session.
+func (c *Client) UpdateConfig(cfg *config.Config) {
+	previous := c.cfg.Swap(cfg)
+	if previous.PIHolePassword != cfg.PIHolePassword {
+		if err := c.apiClient.Logout(); err != nil {
+			c.logger().Warnf("Failed to log out: %v", err)
+		}
+		c.apiClient.SetPassword(cfg.PIHolePassword)
+	}
+	c.logger().Debug("Updated configuration of client")
+}
+
+// logger returns the logger of the client, carrying its hostname.
+func (c *Client) logger() *log.Entry {
+	return log.WithField("hostname", c.config().PIHoleHostname)
 }
 
 func (c *Client) String() string {
-	return c.config.PIHoleHostname
+	return c.config().PIHoleHostname
 }
 
-func (c *Client) CollectMetricsAsync(writer http.ResponseWriter, request *http.Request) {
-	log.Debugf("Collecting from %s", c.config.PIHoleHostname)
-	if stats, blockedDomains, permittedDomains, clients, upstreams, piHoleStatus, err := c.getStatistics(); err == nil {
-		c.setMetrics(stats, blockedDomains, permittedDomains, clients, upstreams, piHoleStatus)
-		c.Status <- &ClientChannel{Status: MetricsCollectionSuccess, Err: nil}
-		log.Debugf("New tick of statistics from %s: %s", c.config.PIHoleHostname, stats)
-	} else {
-		c.Status <- &ClientChannel{Status: MetricsCollectionError, Err: err}
+// collection is a collection shared by the concurrent calls of Collect, which
+// is cancelled once none of them waits for it anymore.
+type collection struct {
+	cancel    context.CancelFunc
+	cancelled bool
+	waiters   int
+	done      chan struct{}
+	result    *CollectionResult
+}
+
+// Collect collects the metrics of the Pi-hole instance and returns the result
+// of the collection. Concurrent calls share the collection in flight, which is
+// aborted once the contexts of all of them are done.
+func (c *Client) Collect(ctx context.Context) (status *CollectionResult) {
+	ctx, span := tracing.Tracer().Start(ctx, "collect", trace.WithAttributes(semconv.ServerAddress(c.GetHostname())))
+	defer func() { endSpan(span, status.Err) }()
+
+	aborted := func() *CollectionResult {
+		err := fmt.Errorf("metrics collection from %s aborted: %w", c.GetHostname(), ctx.Err())
+		return &CollectionResult{Status: collectionErrorStatus(err), Err: err}
+	}
+
+	shared, current := c.join(ctx)
+	if current == nil {
+		return aborted()
+	}
+	// The requests of a shared collection belong to the trace of the scrape
+	// which started it.
+	span.SetAttributes(attribute.Bool("pihole.collection.shared", shared))
+
+	select {
+	case <-current.done:
+		c.leave(current)
+		return current.result
+	case <-ctx.Done():
+		c.leave(current)
+		return aborted()
+	}
+}
+
+// join returns the collection in flight, starting one with the values of ctx
+// if there is none, and whether it was already started. A cancelled collection
+// still running is waited for before starting the next one, so that a single
+// collection sets the metrics of the client at a time. join returns nil if ctx
+// is done meanwhile.
+func (c *Client) join(ctx context.Context) (shared bool, current *collection) {
+	for {
+		c.mu.Lock()
+		current = c.collection
+		if current == nil {
+			break
+		}
+		if !current.cancelled {
+			current.waiters++
+			c.mu.Unlock()
+			return true, current
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-current.done:
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+	defer c.mu.Unlock()
+
+	collectCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	current = &collection{cancel: cancel, waiters: 1, done: make(chan struct{})}
+	c.collection = current
+	go func() {
+		defer cancel()
+		start := time.Now()
+		current.result = &CollectionResult{Status: MetricsCollectionSuccess}
+		if err := c.collect(collectCtx); err != nil {
+			current.result = &CollectionResult{Status: collectionErrorStatus(err), Err: err}
+		}
+		c.recordScrape(current.result, start)
+
+		c.mu.Lock()
+		c.collection = nil
+		c.mu.Unlock()
+		close(current.done)
+	}()
+	return false, current
+}
+
+// leave stops waiting for the collection, cancelling it if nobody waits for it
+// anymore. The next call of Collect starts a new one once it ended.
+func (c *Client) leave(current *collection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current.waiters--
+	if current.waiters == 0 {
+		current.cancelled = true
+		current.cancel()
 	}
 }
 
-func (c *Client) CollectMetrics(writer http.ResponseWriter, request *http.Request) error {
-	stats, blockedDomains, permittedDomains, clients, upstreams, piHoleStatus, err := c.getStatistics()
+// CollectMetrics collects the metrics of the Pi-hole instance, see Collect.
+func (c *Client) CollectMetrics(ctx context.Context) error {
+	return c.Collect(ctx).Err
+}
+
+func (c *Client) collect(ctx context.Context) error {
+	ctx, done, err := c.begin(ctx)
 	if err != nil {
 		return err
 	}
-	c.setMetrics(stats, blockedDomains, permittedDomains, clients, upstreams, piHoleStatus)
-	log.Debugf("New tick of statistics from %s: %s", c.config.PIHoleHostname, stats)
+	defer done()
+
+	c.logger().Debug("Collecting")
+	start := time.Now()
+	stats, err := c.getStatistics(ctx)
+	if err != nil {
+		return err
+	}
+	c.setMetrics(stats)
+
+	if c.envConfig.ReplyTimeHistograms {
+		c.observeReplyTimes(ctx)
+	}
+
+	c.mu.Lock()
+	c.snapshot = NewSnapshot(c.GetHostname(), stats, c.version, time.Now())
+	c.mu.Unlock()
+	c.logger().WithField("duration", time.Since(start).String()).Debugf("New tick of statistics: %s", &stats.Summary)
 	return nil
 }
 
+// collectionErrorStatus returns the status of a collection which failed with
+// the given error.
+func collectionErrorStatus(err error) ClientStatus {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return MetricsCollectionTimeout
+	}
+	return MetricsCollectionError
+}
+
+// begin registers a request made to the Pi-hole API, which is aborted when
+// either ctx is cancelled or the client closed. done must be called once the
+// request ended.
+func (c *Client) begin(ctx context.Context) (requestCtx context.Context, done func(), err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, nil, ErrClientClosed
+	}
+
+	c.inflight.Add(1)
+	requestCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(c.ctx, cancel)
+	return requestCtx, func() {
+		stop()
+		cancel()
+		c.inflight.Done()
+	}, nil
+}
+
+// recordScrape stores the result of a collection started at start.
+func (c *Client) recordScrape(status *CollectionResult, start time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Status = status
+	c.state.Time = time.Now()
+	c.state.Duration = c.state.Time.Sub(start)
+	if status.Err != nil {
+		c.state.LastError = status.Err
+		c.state.LastErrorTime = c.state.Time
+	}
+}
+
+// LastScrape returns the state of the last metrics collection.
+func (c *Client) LastScrape() ScrapeState {
+	c.mu.Lock()
+	state := c.state
+	if c.version != nil {
+		state.Version = c.version.String()
+	}
+	if c.collection != nil && !c.collection.cancelled {
+		state.Waiting = c.collection.waiters
+	}
+	c.mu.Unlock()
+
+	state.SessionValidity = c.apiClient.SessionValidity()
+	return state
+}
+
+// Snapshot returns the normalized state of the Pi-hole instance at the last
+// successful collection, nil before the first one.
+func (c *Client) Snapshot() *Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot
+}
+
+// GetBaseURL returns the URL of the Pi-hole API.
+func (c *Client) GetBaseURL() string {
+	return c.apiClient.BaseURL
+}
+
+// GetRecentBlocked returns the last count domains blocked by Pi-hole, the most
+// recent first.
+func (c *Client) GetRecentBlocked(ctx context.Context, count uint) ([]string, error) {
+	ctx, done, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var recentBlocked RecentBlocked
+	err = c.apiClient.FetchData(ctx, fmt.Sprintf("/api/stats/recent_blocked?count=%d", count), &recentBlocked)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching recently blocked domains: %w", err)
+	}
+	return recentBlocked.Blocked, nil
+}
+
 func (c *Client) GetHostname() string {
-	return c.config.PIHoleHostname
-}
-
-func (c *Client) setMetrics(stats *StatsSummary, blockedDomains *TopDomains, permittedDomains *TopDomains, clients *[]PiHoleClient, upstreams *Upstreams, piHoleStatus *BlockingStatus) {
-	metrics.DomainsBlocked.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Gravity.DomainsBeingBlocked))
-	metrics.DNSQueriesToday.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.Total))
-	metrics.AdsBlockedToday.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.Blocked))
-	metrics.AdsPercentageToday.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.PercentBlocked))
-	metrics.UniqueDomains.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.UniqueDomains))
-	metrics.QueriesForwarded.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.Forwarded))
-	metrics.QueriesCached.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.Cached))
-	metrics.RequestRate.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.Frequency))
-	metrics.ClientsEverSeen.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Clients.Total))
-	metrics.UniqueClients.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Clients.Active))
-	metrics.DNSQueriesAllTypes.WithLabelValues(c.config.PIHoleHostname).Set(float64(stats.Queries.Total))
-	if piHoleStatus.Blocking == "enabled" {
-		metrics.Status.WithLabelValues(c.config.PIHoleHostname).Set(1)
+	return c.config().PIHoleHostname
+}
+
+func (c *Client) setMetrics(stats *Statistics) {
+	summary := stats.Summary
+	hostname := c.config().PIHoleHostname
+
+	metrics.DomainsBlocked.WithLabelValues(hostname).Set(float64(summary.Gravity.DomainsBeingBlocked))
+	metrics.DNSQueriesToday.WithLabelValues(hostname).Set(float64(summary.Queries.Total))
+	metrics.AdsBlockedToday.WithLabelValues(hostname).Set(float64(summary.Queries.Blocked))
+	if c.envConfig.PercentagesAsRatios {
+		metrics.AdsRatioToday.WithLabelValues(hostname).Set(float64(summary.Queries.PercentBlocked) / 100)
 	} else {
-		metrics.Status.WithLabelValues(c.config.PIHoleHostname).Set(0)
+		metrics.AdsPercentageToday.WithLabelValues(hostname).Set(float64(summary.Queries.PercentBlocked))
+	}
+	metrics.UniqueDomains.WithLabelValues(hostname).Set(float64(summary.Queries.UniqueDomains))
+	metrics.QueriesForwarded.WithLabelValues(hostname).Set(float64(summary.Queries.Forwarded))
+	metrics.QueriesCached.WithLabelValues(hostname).Set(float64(summary.Queries.Cached))
+	metrics.RequestRate.WithLabelValues(hostname).Set(float64(summary.Queries.Frequency))
+	metrics.ClientsEverSeen.WithLabelValues(hostname).Set(float64(summary.Clients.Total))
+	metrics.UniqueClients.WithLabelValues(hostname).Set(float64(summary.Clients.Active))
+	metrics.DNSQueriesAllTypes.WithLabelValues(hostname).Set(float64(summary.Queries.Total))
+	if stats.BlockingStatus.Blocking == "enabled" {
+		metrics.Status.WithLabelValues(hostname).Set(1)
+	} else {
+		metrics.Status.WithLabelValues(hostname).Set(0)
 	}
 
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "unknown").Set(float64(stats.Queries.Replies.UNKNOWN))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "no_data").Set(float64(stats.Queries.Replies.NODATA))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "nx_domain").Set(float64(stats.Queries.Replies.NXDOMAIN))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "cname").Set(float64(stats.Queries.Replies.CNAME))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "ip").Set(float64(stats.Queries.Replies.IP))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "domain").Set(float64(stats.Queries.Replies.DOMAIN))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "rr_name").Set(float64(stats.Queries.Replies.RRNAME))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "serv_fail").Set(float64(stats.Queries.Replies.SERVFAIL))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "refused").Set(float64(stats.Queries.Replies.REFUSED))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "not_imp").Set(float64(stats.Queries.Replies.NOTIMP))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "other").Set(float64(stats.Queries.Replies.OTHER))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "dnssec").Set(float64(stats.Queries.Replies.DNSSEC))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "none").Set(float64(stats.Queries.Replies.NONE))
-	metrics.Reply.WithLabelValues(c.config.PIHoleHostname, "blob").Set(float64(stats.Queries.Replies.BLOB))
+	blockingState := stats.BlockingStatus.State()
+	for _, state := range BlockingStates {
+		if state == blockingState {
+			metrics.BlockingState.WithLabelValues(hostname, state).Set(1)
+		} else {
+			metrics.BlockingState.WithLabelValues(hostname, state).Set(0)
+		}
+	}
+	metrics.BlockingTimer.WithLabelValues(hostname).Set(stats.BlockingStatus.TimerSeconds())
+
+	metrics.Reply.WithLabelValues(hostname, "unknown").Set(float64(summary.Queries.Replies.UNKNOWN))
+	metrics.Reply.WithLabelValues(hostname, "no_data").Set(float64(summary.Queries.Replies.NODATA))
+	metrics.Reply.WithLabelValues(hostname, "nx_domain").Set(float64(summary.Queries.Replies.NXDOMAIN))
+	metrics.Reply.WithLabelValues(hostname, "cname").Set(float64(summary.Queries.Replies.CNAME))
+	metrics.Reply.WithLabelValues(hostname, "ip").Set(float64(summary.Queries.Replies.IP))
+	metrics.Reply.WithLabelValues(hostname, "domain").Set(float64(summary.Queries.Replies.DOMAIN))
+	metrics.Reply.WithLabelValues(hostname, "rr_name").Set(float64(summary.Queries.Replies.RRNAME))
+	metrics.Reply.WithLabelValues(hostname, "serv_fail").Set(float64(summary.Queries.Replies.SERVFAIL))
+	metrics.Reply.WithLabelValues(hostname, "refused").Set(float64(summary.Queries.Replies.REFUSED))
+	metrics.Reply.WithLabelValues(hostname, "not_imp").Set(float64(summary.Queries.Replies.NOTIMP))
+	metrics.Reply.WithLabelValues(hostname, "other").Set(float64(summary.Queries.Replies.OTHER))
+	metrics.Reply.WithLabelValues(hostname, "dnssec").Set(float64(summary.Queries.Replies.DNSSEC))
+	metrics.Reply.WithLabelValues(hostname, "none").Set(float64(summary.Queries.Replies.NONE))
+	metrics.Reply.WithLabelValues(hostname, "blob").Set(float64(summary.Queries.Replies.BLOB))
+
+	// Top lists change members between collections, the series which left a
+	// list are deleted so that they do not linger forever.
+	var topQueries, topAds, topSources, topSourcesBlocked, topClientAds, topUpstreams []metrics.Series
+	for _, domain := range stats.PermittedDomains.Domains {
+		topQueries = append(topQueries, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "domain": domain.Domain}, Value: float64(domain.Count)})
+	}
+	for _, domain := range stats.BlockedDomains.Domains {
+		topAds = append(topAds, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "domain": domain.Domain}, Value: float64(domain.Count)})
+	}
+	for _, client := range stats.PermittedClients {
+		topSources = append(topSources, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "source": client.IP, "source_name": client.Name}, Value: float64(client.Count)})
+	}
+	for _, client := range stats.BlockedClients {
+		topSourcesBlocked = append(topSourcesBlocked, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "source": client.IP, "source_name": client.Name}, Value: float64(client.Count)})
+	}
+	for _, clientAds := range stats.ClientAds {
+		for _, domain := range clientAds.Domains.Domains {
+			topClientAds = append(topClientAds, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "source": clientAds.Client.IP, "source_name": clientAds.Client.Name, "domain": domain.Domain}, Value: float64(domain.Count)})
+		}
+	}
+	for _, upstream := range stats.SlowestUpstreams {
+		topUpstreams = append(topUpstreams, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "destination": upstream.IP, "destination_name": upstream.Name}, Value: upstream.Statistics.Response})
+	}
+	metrics.ReplaceSeries(metrics.TopQueries, hostname, topQueries)
+	metrics.ReplaceSeries(metrics.TopAds, hostname, topAds)
+	metrics.ReplaceSeries(metrics.TopSources, hostname, topSources)
+	metrics.ReplaceSeries(metrics.TopSourcesBlocked, hostname, topSourcesBlocked)
+	metrics.ReplaceSeries(metrics.TopClientAds, hostname, topClientAds)
+	metrics.ReplaceSeries(metrics.TopUpstreamsResponseTime, hostname, topUpstreams)
+
+	metrics.TopListEntries.WithLabelValues(hostname, "top_queries").Set(float64(len(stats.PermittedDomains.Domains)))
+	metrics.TopListEntries.WithLabelValues(hostname, "top_ads").Set(float64(len(stats.BlockedDomains.Domains)))
+	metrics.TopListEntries.WithLabelValues(hostname, "top_sources").Set(float64(len(stats.PermittedClients)))
+	metrics.TopListEntries.WithLabelValues(hostname, "top_sources_blocked").Set(float64(len(stats.BlockedClients)))
+	metrics.TopListEntries.WithLabelValues(hostname, "top_client_ads").Set(float64(len(topClientAds)))
+	metrics.TopListEntries.WithLabelValues(hostname, "top_upstreams_responsetime").Set(float64(len(stats.SlowestUpstreams)))
+
+	for _, upstream := range stats.Upstreams.Upstreams {
+		metrics.ForwardDestinations.WithLabelValues(hostname, upstream.IP, upstream.Name).Set(float64(upstream.Count))
+		metrics.ForwardDestinationsResponseTime.WithLabelValues(hostname, upstream.IP, upstream.Name).Set(upstream.Statistics.Response)
+		metrics.ForwardDestinationsResponseTimeSeconds.WithLabelValues(hostname, upstream.IP, upstream.Name).Set(upstream.Statistics.Response)
+		metrics.ForwardDestinationsResponseVariance.WithLabelValues(hostname, upstream.IP, upstream.Name).Set(upstream.Statistics.Variance)
+	}
 
-	for _, domain := range permittedDomains.Domains {
-		metrics.TopQueries.WithLabelValues(c.config.PIHoleHostname, domain.Domain).Set(float64(domain.Count))
+	for queryType, value := range summary.Queries.Types {
+		metrics.QueryTypes.WithLabelValues(hostname, queryType).Set(value)
 	}
 
-	for _, domain := range blockedDomains.Domains {
-		metrics.TopAds.WithLabelValues(c.config.PIHoleHostname, domain.Domain).Set(float64(domain.Count))
+	if stats.Inventory != nil {
+		c.setInventoryMetrics(stats.Inventory)
 	}
+}
 
-	for _, client := range *clients {
-		metrics.TopSources.WithLabelValues(c.config.PIHoleHostname, client.IP, client.Name).Set(float64(client.Count))
+func (c *Client) setInventoryMetrics(inventory *Inventory) {
+	hostname := c.config().PIHoleHostname
+
+	var groupEnabled []metrics.Series
+	enabledGroups, disabledGroups := 0, 0
+	for _, group := range inventory.Groups.Groups {
+		enabled := 0.0
+		if group.Enabled {
+			enabledGroups++
+			enabled = 1
+		} else {
+			disabledGroups++
+		}
+		groupEnabled = append(groupEnabled, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "group": group.Name}, Value: enabled})
 	}
+	metrics.ReplaceSeries(metrics.GroupEnabled, hostname, groupEnabled)
+	metrics.Groups.WithLabelValues(hostname, "enabled").Set(float64(enabledGroups))
+	metrics.Groups.WithLabelValues(hostname, "disabled").Set(float64(disabledGroups))
 
-	for _, upstream := range upstreams.Upstreams {
-		metrics.ForwardDestinations.WithLabelValues(c.config.PIHoleHostname, upstream.IP, upstream.Name).Set(float64(upstream.Count))
-		metrics.ForwardDestinationsResponseTime.WithLabelValues(c.config.PIHoleHostname, upstream.IP, upstream.Name).Set(upstream.Statistics.Response)
-		metrics.ForwardDestinationsResponseVariance.WithLabelValues(c.config.PIHoleHostname, upstream.IP, upstream.Name).Set(upstream.Statistics.Variance)
+	var groupClients []metrics.Series
+	for group, count := range inventory.GroupClients() {
+		groupClients = append(groupClients, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "group": group}, Value: float64(count)})
 	}
+	metrics.ReplaceSeries(metrics.GroupClients, hostname, groupClients)
 
-	for queryType, value := range stats.Queries.Types {
-		metrics.QueryTypes.WithLabelValues(c.config.PIHoleHostname, queryType).Set(value)
+	var domainRules []metrics.Series
+	for key, count := range inventory.EnabledDomainRules() {
+		domainRules = append(domainRules, metrics.Series{Labels: prometheus.Labels{"hostname": hostname, "group": key.Group, "type": key.Type, "kind": key.Kind}, Value: float64(count)})
+	}
+	metrics.ReplaceSeries(metrics.DomainRules, hostname, domainRules)
+
+	for list, hash := range inventory.Hashes() {
+		metrics.InventoryHash.WithLabelValues(hostname, list).Set(hash)
 	}
 }
 
-func (c *Client) getStatistics() (*StatsSummary, *TopDomains, *TopDomains, *[]PiHoleClient, *Upstreams, *BlockingStatus, error) {
-	var statsSummary StatsSummary
-	var permittedDomains TopDomains
-	var blockedDomains TopDomains
-	var permittedClients TopClients
-	var blockedClients TopClients
-	var upstreams Upstreams
-	var piHoleStatus BlockingStatus
+// detectVersion fetches the version of Pi-hole once, a failure is not fatal to
+// the collection and is retried on the next one.
+func (c *Client) detectVersion(ctx context.Context) {
+	c.mu.Lock()
+	detected := c.version != nil
+	c.mu.Unlock()
+	if detected {
+		return
+	}
 
-	err := c.apiClient.FetchData("/api/stats/summary", &statsSummary)
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error fetching stats summary: %w", err)
+	var version Version
+	if err := c.apiClient.FetchData(ctx, "/api/info/version", &version); err != nil {
+		c.logger().Debugf("Unable to detect the version: %v", err)
+		return
 	}
 
-	err = c.apiClient.FetchData("/api/stats/top_domains?blocked=true&count=10", &blockedDomains)
+	c.mu.Lock()
+	c.version = &version
+	c.mu.Unlock()
+}
+
+func (c *Client) getInventory(ctx context.Context) (*Inventory, error) {
+	var inventory Inventory
+
+	err := c.apiClient.FetchData(ctx, "/api/groups", &inventory.Groups)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error fetching blocked domains: %w", err)
+		return nil, fmt.Errorf("error fetching groups: %w", err)
 	}
-	err = c.apiClient.FetchData("/api/stats/top_domains?blocked=false&count=10", &permittedDomains)
+
+	err = c.apiClient.FetchData(ctx, "/api/clients", &inventory.Clients)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error fetching permitted domains: %w", err)
+		return nil, fmt.Errorf("error fetching clients: %w", err)
 	}
 
-	err = c.apiClient.FetchData("/api/stats/top_clients?blocked=true&count=10", &blockedClients)
+	err = c.apiClient.FetchData(ctx, "/api/domains", &inventory.Domains)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error fetching blocked clients: %w", err)
+		return nil, fmt.Errorf("error fetching domains: %w", err)
 	}
-	err = c.apiClient.FetchData("/api/stats/top_clients?blocked=false&count=10", &permittedClients)
+
+	return &inventory, nil
+}
+
+func (c *Client) getStatistics(ctx context.Context) (*Statistics, error) {
+	stats := &Statistics{}
+	topLists := c.config().TopLists
+
+	err := c.apiClient.FetchData(ctx, "/api/stats/summary", &stats.Summary)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error fetching permitted clients: %w", err)
+		return nil, fmt.Errorf("error fetching stats summary: %w", err)
+	}
+
+	if topLists.Ads > 0 {
+		err = c.apiClient.FetchData(ctx, fmt.Sprintf("/api/stats/top_domains?blocked=true&count=%d", topLists.Ads), &stats.BlockedDomains)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching blocked domains: %w", err)
+		}
+	}
+	if topLists.Queries > 0 {
+		err = c.apiClient.FetchData(ctx, fmt.Sprintf("/api/stats/top_domains?blocked=false&count=%d", topLists.Queries), &stats.PermittedDomains)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching permitted domains: %w", err)
+		}
+	}
+
+	if topLists.SourcesBlocked > 0 {
+		var blockedClients TopClients
+		err = c.apiClient.FetchData(ctx, fmt.Sprintf("/api/stats/top_clients?blocked=true&count=%d", topLists.SourcesBlocked), &blockedClients)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching blocked clients: %w", err)
+		}
+		stats.BlockedClients = AggregateClients(blockedClients.Clients)
+	}
+	if topLists.Sources > 0 {
+		var permittedClients TopClients
+		err = c.apiClient.FetchData(ctx, fmt.Sprintf("/api/stats/top_clients?blocked=false&count=%d", topLists.Sources), &permittedClients)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching permitted clients: %w", err)
+		}
+		stats.PermittedClients = AggregateClients(permittedClients.Clients)
 	}
 
-	clients := MergeClients(permittedClients.Clients, blockedClients.Clients)
+	// Top blocked domains are only requested for the clients of the top
+	// blocked clients list, which keeps the number of requests bounded.
+	if topLists.ClientAds > 0 {
+		for _, client := range stats.BlockedClients {
+			clientAds := ClientTopDomains{Client: client}
+			endpoint := fmt.Sprintf("/api/stats/top_domains?blocked=true&count=%d&client=%s", topLists.ClientAds, url.QueryEscape(client.IP))
+			err = c.apiClient.FetchData(ctx, endpoint, &clientAds.Domains)
+			if err != nil {
+				return nil, fmt.Errorf("error fetching blocked domains of client %s: %w", client.IP, err)
+			}
+			stats.ClientAds = append(stats.ClientAds, clientAds)
+		}
+	}
 
-	err = c.apiClient.FetchData("/api/stats/upstreams", &upstreams)
+	err = c.apiClient.FetchData(ctx, "/api/stats/upstreams", &stats.Upstreams)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error fetching upstream stats: %w", err)
+		return nil, fmt.Errorf("error fetching upstream stats: %w", err)
 	}
+	stats.SlowestUpstreams = stats.Upstreams.SlowestUpstreams(int(topLists.UpstreamsByResponse))
 
-	err = c.apiClient.FetchData("/api/dns/blocking", &piHoleStatus)
+	err = c.apiClient.FetchData(ctx, "/api/dns/blocking", &stats.BlockingStatus)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error fetching status: %w", err)
+		return nil, fmt.Errorf("error fetching status: %w", err)
 	}
 
-	return &statsSummary, &blockedDomains, &permittedDomains, &clients, &upstreams, &piHoleStatus, nil
+	// The inventory is optional, its metrics keep their previous values when
+	// it cannot be fetched.
+	if c.config().Inventory {
+		if stats.Inventory, err = c.getInventory(ctx); err != nil {
+			c.logger().Warnf("Failed to fetch the inventory: %v", err)
+		}
+	}
+
+	c.detectVersion(ctx)
+
+	return stats, nil
 }
 
-// Close cleans up resources used by the client
+// Close aborts the requests in flight, waits for them to end and logs out
+// from the Pi-hole API. Requests made after Close fail with ErrClientClosed.
 func (c *Client) Close() {
-	// Drain the status channel if needed
-	select {
-	case <-c.Status:
-		// Channel had something, now it's drained
-	default:
-		// Channel was already empty
+	c.mu.Lock()
+	closed := c.closed
+	c.closed = true
+	c.mu.Unlock()
+	if closed {
+		return
 	}
 
-	log.Debugf("Closing client %s", c.config.PIHoleHostname)
+	c.logger().Debug("Closing client")
+	c.cancel()
+	c.inflight.Wait()
+
+	if err := c.apiClient.Logout(); err != nil {
+		c.logger().Warnf("Failed to log out: %v", err)
+	}
 	c.apiClient.Close() // Close the API client
 }
@@ -0,0 +1,56 @@
+package pihole_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+// TestCollect_Aborted tests that a collection nobody waits for anymore is cancelled
+func TestCollect_Aborted(t *testing.T) {
+	requested := make(chan struct{})
+	cancelled := make(chan struct{})
+	var requestedOnce, cancelledOnce sync.Once
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth" {
+			_, _ = w.Write([]byte(`{"session":{"valid":true,"sid":"sid","validity":300}}`))
+			return
+		}
+		requestedOnce.Do(func() { close(requested) })
+		<-r.Context().Done()
+		cancelledOnce.Do(func() { close(cancelled) })
+	}))
+	defer stub.Close()
+
+	cfg := piholetest.Config(t, stub, "127.0.0.1", "secret")
+	client := pihole.NewClient(&cfg, &config.EnvConfig{Timeout: time.Minute})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan *pihole.CollectionResult)
+	go func() { results <- client.Collect(ctx) }()
+
+	<-requested
+	cancel()
+	result := <-results
+	assert.ErrorIs(t, result.Err, context.Canceled)
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the collection was not cancelled")
+	}
+
+	// The aborted collection is recorded as failed.
+	require.Eventually(t, func() bool { return client.LastScrape().Status != nil }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, pihole.MetricsCollectionError, client.LastScrape().Status.Status)
+}
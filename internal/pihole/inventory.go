@@ -0,0 +1,150 @@
+package pihole
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type Group struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+	Enabled bool   `json:"enabled"`
+}
+
+type Groups struct {
+	Groups []Group `json:"groups"`
+	Took   float64 `json:"took"`
+}
+
+type ManagedClient struct {
+	ID     int    `json:"id"`
+	Client string `json:"client"`
+	Groups []int  `json:"groups"`
+}
+
+type ManagedClients struct {
+	Clients []ManagedClient `json:"clients"`
+	Took    float64         `json:"took"`
+}
+
+type DomainRule struct {
+	ID      int    `json:"id"`
+	Domain  string `json:"domain"`
+	Type    string `json:"type"`
+	Kind    string `json:"kind"`
+	Enabled bool   `json:"enabled"`
+	Groups  []int  `json:"groups"`
+}
+
+type DomainRules struct {
+	Domains []DomainRule `json:"domains"`
+	Took    float64      `json:"took"`
+}
+
+// Inventory is the group, client and domain list management state of a
+// Pi-hole instance.
+type Inventory struct {
+	Groups  Groups
+	Clients ManagedClients
+	Domains DomainRules
+}
+
+// DomainRuleKey identifies a family of domain rules within a group.
+type DomainRuleKey struct {
+	Group string
+	Type  string
+	Kind  string
+}
+
+// GroupName returns the name of the group with the given ID, falling back to
+// the ID itself for a group that is not known.
+func (i *Inventory) GroupName(id int) string {
+	for _, group := range i.Groups.Groups {
+		if group.ID == id {
+			return group.Name
+		}
+	}
+	return strconv.Itoa(id)
+}
+
+// GroupClients returns the number of clients assigned to each group, by name.
+// Every known group is present, even without any client.
+func (i *Inventory) GroupClients() map[string]int {
+	counts := make(map[string]int, len(i.Groups.Groups))
+	for _, group := range i.Groups.Groups {
+		counts[group.Name] = 0
+	}
+	for _, client := range i.Clients.Clients {
+		for _, id := range client.Groups {
+			counts[i.GroupName(id)]++
+		}
+	}
+	return counts
+}
+
+// EnabledDomainRules returns the number of enabled domain rules for each
+// group, type (allow or deny) and kind (exact or regex).
+func (i *Inventory) EnabledDomainRules() map[DomainRuleKey]int {
+	counts := make(map[DomainRuleKey]int)
+	for _, domain := range i.Domains.Domains {
+		if !domain.Enabled {
+			continue
+		}
+		for _, id := range domain.Groups {
+			counts[DomainRuleKey{Group: i.GroupName(id), Type: domain.Type, Kind: domain.Kind}]++
+		}
+	}
+	return counts
+}
+
+// Hashes returns a fingerprint of the groups, clients and domains lists.
+// Database IDs and timestamps are left out and groups are referenced by name,
+// so that two instances managed from the same source yield the same values.
+func (i *Inventory) Hashes() map[string]float64 {
+	groups := make([]string, 0, len(i.Groups.Groups))
+	for _, group := range i.Groups.Groups {
+		groups = append(groups, fmt.Sprintf("%s|%t", group.Name, group.Enabled))
+	}
+
+	clients := make([]string, 0, len(i.Clients.Clients))
+	for _, client := range i.Clients.Clients {
+		clients = append(clients, fmt.Sprintf("%s|%v", client.Client, i.groupNames(client.Groups)))
+	}
+
+	domains := make([]string, 0, len(i.Domains.Domains))
+	for _, domain := range i.Domains.Domains {
+		domains = append(domains, fmt.Sprintf("%s|%s|%s|%t|%v", domain.Domain, domain.Type, domain.Kind, domain.Enabled, i.groupNames(domain.Groups)))
+	}
+
+	return map[string]float64{
+		"groups":  hashAsMetricValue(groups),
+		"clients": hashAsMetricValue(clients),
+		"domains": hashAsMetricValue(domains),
+	}
+}
+
+func (i *Inventory) groupNames(ids []int) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, i.GroupName(id))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hashAsMetricValue hashes the sorted entries and keeps the first 6 bytes of
+// the digest, which fit in a float64 without loss of precision.
+func hashAsMetricValue(entries []string) float64 {
+	sort.Strings(entries)
+	data, _ := json.Marshal(entries)
+	sum := sha256.Sum256(data)
+
+	var bytes [8]byte
+	copy(bytes[2:], sum[:6])
+	return float64(binary.BigEndian.Uint64(bytes[:]))
+}
@@ -0,0 +1,94 @@
+package pihole_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+const (
+	groupsJSON = `{"groups":[
+		{"id":0,"name":"Default","enabled":true,"date_added":1},
+		{"id":3,"name":"Kids","enabled":false,"date_added":2}]}`
+	clientsJSON = `{"clients":[
+		{"id":1,"client":"192.168.1.20","groups":[0,3]},
+		{"id":2,"client":"192.168.1.21","groups":[3]}]}`
+	domainsJSON = `{"domains":[
+		{"id":1,"domain":"ads.example.com","type":"deny","kind":"exact","enabled":true,"groups":[0,3]},
+		{"id":2,"domain":"(^|\\.)tiktok\\.com$","type":"deny","kind":"regex","enabled":true,"groups":[3]},
+		{"id":3,"domain":"good.example.com","type":"allow","kind":"exact","enabled":false,"groups":[0]}]}`
+)
+
+func loadInventory(t *testing.T, groups, clients, domains string) *pihole.Inventory {
+	t.Helper()
+	var inventory pihole.Inventory
+	require.NoError(t, json.Unmarshal([]byte(groups), &inventory.Groups))
+	require.NoError(t, json.Unmarshal([]byte(clients), &inventory.Clients))
+	require.NoError(t, json.Unmarshal([]byte(domains), &inventory.Domains))
+	return &inventory
+}
+
+// TestInventory_Counts tests the per group client and domain rule counts
+func TestInventory_Counts(t *testing.T) {
+	inventory := loadInventory(t, groupsJSON, clientsJSON, domainsJSON)
+
+	assert.Equal(t, map[string]int{"Default": 1, "Kids": 2}, inventory.GroupClients())
+	assert.Equal(t, map[pihole.DomainRuleKey]int{
+		{Group: "Default", Type: "deny", Kind: "exact"}: 1,
+		{Group: "Kids", Type: "deny", Kind: "exact"}:    1,
+		{Group: "Kids", Type: "deny", Kind: "regex"}:    1,
+	}, inventory.EnabledDomainRules())
+	assert.Equal(t, "42", inventory.GroupName(42))
+}
+
+// TestInventory_Hashes tests that hashes ignore IDs and ordering but not state
+func TestInventory_Hashes(t *testing.T) {
+	inventory := loadInventory(t, groupsJSON, clientsJSON, domainsJSON)
+
+	renumbered := loadInventory(t,
+		`{"groups":[{"id":7,"name":"Kids","enabled":false},{"id":0,"name":"Default","enabled":true}]}`,
+		`{"clients":[{"id":9,"client":"192.168.1.21","groups":[7]},{"id":8,"client":"192.168.1.20","groups":[7,0]}]}`,
+		domainsJSON,
+	)
+	renumbered.Domains.Domains[1].Groups = []int{7}
+	renumbered.Domains.Domains[0].Groups = []int{7, 0}
+	assert.Equal(t, inventory.Hashes(), renumbered.Hashes())
+
+	inventory.Groups.Groups[1].Enabled = true
+	hashes := inventory.Hashes()
+	assert.NotEqual(t, renumbered.Hashes()["groups"], hashes["groups"])
+	assert.Equal(t, renumbered.Hashes()["domains"], hashes["domains"])
+}
+
+// TestCollect_InventoryUnavailable tests that an inventory which cannot be fetched does not fail the collection
+func TestCollect_InventoryUnavailable(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/auth":
+			_, _ = w.Write([]byte(`{"session":{"valid":true,"sid":"sid","validity":300}}`))
+		case "/api/groups":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer stub.Close()
+
+	cfg := piholetest.Config(t, stub, "127.0.0.1", "secret")
+	cfg.Inventory = true
+	client := pihole.NewClient(&cfg, &config.EnvConfig{Timeout: time.Second})
+	defer client.Close()
+
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	assert.NotNil(t, client.Snapshot())
+}
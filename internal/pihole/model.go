@@ -1,27 +1,88 @@
 package pihole
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
+
+// BlockingStates lists the blocking states reported by FTL.
+var BlockingStates = []string{"enabled", "disabled", "failed", "unknown"}
 
 type BlockingStatus struct {
-	Blocking string  `json:"blocking"`
-	Timer    int     `json:"timer"`
-	Took     float64 `json:"took"`
+	Blocking string `json:"blocking"`
+	// Timer is the remaining time in seconds before the blocking state is
+	// reverted, null when no timer is running.
+	Timer *float64 `json:"timer"`
+	Took  float64  `json:"took"`
+}
+
+// State returns the blocking state, or "unknown" for a state that is not
+// one of BlockingStates.
+func (b *BlockingStatus) State() string {
+	for _, state := range BlockingStates {
+		if b.Blocking == state {
+			return state
+		}
+	}
+	return "unknown"
+}
+
+// TimerSeconds returns the remaining time in seconds before the blocking
+// state is reverted, 0 when no timer is running.
+func (b *BlockingStatus) TimerSeconds() float64 {
+	if b.Timer == nil || *b.Timer < 0 {
+		return 0
+	}
+	return *b.Timer
+}
+
+type Version struct {
+	Version struct {
+		Core struct {
+			Local struct {
+				Version string `json:"version"`
+			} `json:"local"`
+		} `json:"core"`
+		Web struct {
+			Local struct {
+				Version string `json:"version"`
+			} `json:"local"`
+		} `json:"web"`
+		FTL struct {
+			Local struct {
+				Version string `json:"version"`
+			} `json:"local"`
+		} `json:"ftl"`
+	} `json:"version"`
+	Took float64 `json:"took"`
+}
+
+// String returns the core, web and FTL versions of a Pi-hole instance.
+func (v *Version) String() string {
+	return fmt.Sprintf("Core %s, Web %s, FTL %s", v.Version.Core.Local.Version, v.Version.Web.Local.Version, v.Version.FTL.Local.Version)
+}
+
+type RecentBlocked struct {
+	Blocked []string `json:"blocked"`
+	Took    float64  `json:"took"`
+}
+
+type Upstream struct {
+	IP         string `json:"ip"`
+	Name       string `json:"name"`
+	Port       int    `json:"port"`
+	Count      int    `json:"count"`
+	Statistics struct {
+		Response float64 `json:"response"`
+		Variance float64 `json:"variance"`
+	} `json:"statistics"`
 }
 
 type Upstreams struct {
-	Upstreams []struct {
-		IP         string `json:"ip"`
-		Name       string `json:"name"`
-		Port       int    `json:"port"`
-		Count      int    `json:"count"`
-		Statistics struct {
-			Response float64 `json:"response"`
-			Variance float64 `json:"variance"`
-		} `json:"statistics"`
-	} `json:"upstreams"`
-	ForwardedQueries int     `json:"forwarded_queries"`
-	TotalQueries     int     `json:"total_queries"`
-	Took             float64 `json:"took"`
+	Upstreams        []Upstream `json:"upstreams"`
+	ForwardedQueries int        `json:"forwarded_queries"`
+	TotalQueries     int        `json:"total_queries"`
+	Took             float64    `json:"took"`
 }
 
 type TopDomains struct {
@@ -34,6 +95,12 @@ type TopDomains struct {
 	Took           float64 `json:"took"`
 }
 
+// ClientTopDomains holds the top domains requested by a single client.
+type ClientTopDomains struct {
+	Client  PiHoleClient
+	Domains TopDomains
+}
+
 type PiHoleClient struct {
 	IP    string `json:"ip"`
 	Name  string `json:"name"`
@@ -107,36 +174,83 @@ type StatsSummary struct {
 	Took float64 `json:"took"`
 }
 
+// Statistics gathers everything collected from a Pi-hole instance in one tick.
+type Statistics struct {
+	Summary          StatsSummary
+	BlockedDomains   TopDomains
+	PermittedDomains TopDomains
+	PermittedClients []PiHoleClient
+	BlockedClients   []PiHoleClient
+	ClientAds        []ClientTopDomains
+	Upstreams        Upstreams
+	SlowestUpstreams []Upstream
+	BlockingStatus   BlockingStatus
+	Inventory        *Inventory
+}
+
+// SlowestUpstreams returns at most count upstreams, ordered by descending
+// average response time.
+func (u *Upstreams) SlowestUpstreams(count int) []Upstream {
+	if count <= 0 {
+		return nil
+	}
+
+	upstreams := make([]Upstream, len(u.Upstreams))
+	copy(upstreams, u.Upstreams)
+	sort.SliceStable(upstreams, func(i, j int) bool {
+		return upstreams[i].Statistics.Response > upstreams[j].Statistics.Response
+	})
+
+	if len(upstreams) > count {
+		upstreams = upstreams[:count]
+	}
+	return upstreams
+}
+
 // ToString method returns a string of the current statistics struct.
 func (s *StatsSummary) String() string {
 	return fmt.Sprintf("%d ads blocked / %d total DNS queries", s.Queries.Blocked, s.Queries.Total)
 }
 
-func MergeClients(clients1, clients2 []PiHoleClient) []PiHoleClient {
-	clientMap := make(map[string]PiHoleClient)
+// clientKey identifies a client by both its address and its resolved name, so
+// that two hosts sharing a name (or one address seen under two names) are kept
+// as distinct series.
+type clientKey struct {
+	IP   string
+	Name string
+}
+
+// AggregateClients folds duplicated entries of a top clients list into one
+// entry per IP and name pair, summing their counts. The result is ordered by
+// descending count, then by IP and name.
+func AggregateClients(clients []PiHoleClient) []PiHoleClient {
+	clientMap := make(map[clientKey]PiHoleClient, len(clients))
 
-	// Function to add clients to the map
-	addClients := func(clients []PiHoleClient) {
-		for _, client := range clients {
-			key := client.IP // or client.Name if IPs are not unique
-			if existing, found := clientMap[key]; found {
-				existing.Count += client.Count
-				clientMap[key] = existing
-			} else {
-				clientMap[key] = client
-			}
+	for _, client := range clients {
+		key := clientKey{IP: client.IP, Name: client.Name}
+		if existing, found := clientMap[key]; found {
+			existing.Count += client.Count
+			clientMap[key] = existing
+		} else {
+			clientMap[key] = client
 		}
 	}
 
-	// Add both arrays
-	addClients(clients1)
-	addClients(clients2)
-
-	// Convert map back to slice
-	mergedClients := make([]PiHoleClient, 0, len(clientMap))
+	aggregatedClients := make([]PiHoleClient, 0, len(clientMap))
 	for _, client := range clientMap {
-		mergedClients = append(mergedClients, client)
+		aggregatedClients = append(aggregatedClients, client)
 	}
 
-	return mergedClients
+	sort.Slice(aggregatedClients, func(i, j int) bool {
+		a, b := aggregatedClients[i], aggregatedClients[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.IP != b.IP {
+			return a.IP < b.IP
+		}
+		return a.Name < b.Name
+	})
+
+	return aggregatedClients
 }
@@ -0,0 +1,81 @@
+package pihole_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+// TestAggregateClients tests that clients are keyed by both IP and name
+func TestAggregateClients(t *testing.T) {
+	clients := []pihole.PiHoleClient{
+		{IP: "192.168.1.10", Name: "laptop", Count: 5},
+		{IP: "192.168.1.10", Name: "laptop.lan", Count: 3},
+		{IP: "192.168.1.11", Name: "laptop", Count: 7},
+		{IP: "192.168.1.10", Name: "laptop", Count: 2},
+		{IP: "::1", Name: "", Count: 3},
+	}
+
+	got := pihole.AggregateClients(clients)
+
+	assert.Equal(t, []pihole.PiHoleClient{
+		{IP: "192.168.1.10", Name: "laptop", Count: 7},
+		{IP: "192.168.1.11", Name: "laptop", Count: 7},
+		{IP: "192.168.1.10", Name: "laptop.lan", Count: 3},
+		{IP: "::1", Name: "", Count: 3},
+	}, got)
+}
+
+// TestAggregateClients_Empty tests that an empty list stays empty
+func TestAggregateClients_Empty(t *testing.T) {
+	assert.Empty(t, pihole.AggregateClients(nil))
+}
+
+// TestSlowestUpstreams tests that upstreams are ranked by response time
+func TestSlowestUpstreams(t *testing.T) {
+	upstreams := pihole.Upstreams{Upstreams: make([]pihole.Upstream, 3)}
+	for i, response := range []float64{0.01, 0.2, 0.05} {
+		upstreams.Upstreams[i].IP = fmt.Sprintf("10.0.0.%d", i+1)
+		upstreams.Upstreams[i].Statistics.Response = response
+	}
+
+	got := upstreams.SlowestUpstreams(2)
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, "10.0.0.2", got[0].IP)
+		assert.Equal(t, "10.0.0.3", got[1].IP)
+	}
+
+	assert.Len(t, upstreams.SlowestUpstreams(10), 3)
+	assert.Empty(t, upstreams.SlowestUpstreams(0))
+	assert.Equal(t, "10.0.0.1", upstreams.Upstreams[0].IP, "original order must be kept")
+}
+
+// TestBlockingStatus tests the decoding of the blocking state and timer
+func TestBlockingStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		wantState string
+		wantTimer float64
+	}{
+		{"enabled", `{"blocking":"enabled","timer":null}`, "enabled", 0},
+		{"temporarily disabled", `{"blocking":"disabled","timer":42.5}`, "disabled", 42.5},
+		{"failed", `{"blocking":"failed"}`, "failed", 0},
+		{"unexpected", `{"blocking":"paused","timer":-1}`, "unknown", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var status pihole.BlockingStatus
+			if err := json.Unmarshal([]byte(tc.payload), &status); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			assert.Equal(t, tc.wantState, status.State())
+			assert.Equal(t, tc.wantTimer, status.TimerSeconds())
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Package piholetest provides a fake Pi-hole API and clients targeting it, for
+// the tests.
+package piholetest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+// NewServer returns a fake Pi-hole API, closed on cleanup, accepting any
+// password. It answers each path of responses with its JSON encoding, or
+// calls it when it is an http.HandlerFunc. The other paths are not found.
+func NewServer(t testing.TB, responses map[string]any) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	if _, ok := responses["/api/auth"]; !ok {
+		mux.HandleFunc("/api/auth", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`{"session":{"valid":true,"sid":"sid","validity":300}}`))
+		})
+	}
+	for endpoint, response := range responses {
+		if handler, ok := response.(http.HandlerFunc); ok {
+			mux.Handle(endpoint, handler)
+			continue
+		}
+		mux.HandleFunc(endpoint, func(w http.ResponseWriter, _ *http.Request) {
+			_ = json.NewEncoder(w).Encode(response)
+		})
+	}
+	stub := httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// Config returns the configuration of the Pi-hole instance served by stub
+// through hostname, which must resolve to the loopback address.
+func Config(t testing.TB, stub *httptest.Server, hostname, password string) config.Config {
+	t.Helper()
+	_, port, err := net.SplitHostPort(stub.Listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	require.NoError(t, err)
+	return config.Config{PIHoleProtocol: "http", PIHoleHostname: hostname, PIHolePort: uint16(portNumber), PIHolePassword: password}
+}
+
+// NewClient returns a client of the Pi-hole instance served by stub through
+// hostname, closed on cleanup.
+func NewClient(t testing.TB, stub *httptest.Server, hostname string, envConfig *config.EnvConfig) *pihole.Client {
+	t.Helper()
+	cfg := Config(t, stub, hostname, "secret")
+	client := pihole.NewClient(&cfg, envConfig)
+	t.Cleanup(client.Close)
+	return client
+}
@@ -0,0 +1,60 @@
+package pihole
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/config"
+)
+
+// targetKey identifies the Pi-hole instance targeted by a configuration.
+func targetKey(cfg *config.Config) string {
+	return fmt.Sprintf("%s://%s:%d", cfg.PIHoleProtocol, cfg.PIHoleHostname, cfg.PIHolePort)
+}
+
+// Reconcile returns the clients matching the given configurations. The current
+// client of a target that is kept is reused, with its configuration updated in
+// place, and new clients are created for the added targets. The clients of the
+// removed targets are returned apart and left to the caller to close.
+//
+// A change of the timeout or of the TLS verification setting recreates every
+// client, the previous ones being returned as removed.
+func Reconcile(current []*Client, configs []config.Config, envConfig *config.EnvConfig) (clients []*Client, removed []*Client) {
+	byTarget := make(map[string]*Client, len(current))
+	for _, client := range current {
+		if client.envConfig.Timeout == envConfig.Timeout && client.envConfig.SkipTLSVerification == envConfig.SkipTLSVerification {
+			byTarget[targetKey(client.config())] = client
+		}
+	}
+
+	kept := make(map[*Client]bool, len(current))
+	clients = make([]*Client, 0, len(configs))
+	for i := range configs {
+		cfg := &configs[i]
+		key := targetKey(cfg)
+
+		client, found := byTarget[key]
+		if !found || kept[client] {
+			log.WithField("hostname", cfg.PIHoleHostname).Infof("Adding target %s", key)
+			clients = append(clients, NewClient(cfg, envConfig))
+			continue
+		}
+
+		kept[client] = true
+		if *client.config() != *cfg {
+			client.logger().Infof("Updating target %s", key)
+			client.UpdateConfig(cfg)
+		}
+		clients = append(clients, client)
+	}
+
+	for _, client := range current {
+		if !kept[client] {
+			client.logger().Infof("Removing target %s", targetKey(client.config()))
+			removed = append(removed, client)
+		}
+	}
+
+	return clients, removed
+}
@@ -0,0 +1,114 @@
+package pihole_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+// authRecorder is a fake Pi-hole API recording the authentications and logouts.
+type authRecorder struct {
+	mu        sync.Mutex
+	passwords []string
+	logouts   []string
+}
+
+func (a *authRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/api/auth" && r.Method == http.MethodPost:
+		var payload map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		a.passwords = append(a.passwords, payload["password"])
+		sid := "sid" + strconv.Itoa(len(a.passwords))
+		_, _ = w.Write([]byte(`{"session":{"valid":true,"sid":"` + sid + `","validity":300}}`))
+	case r.URL.Path == "/api/auth" && r.Method == http.MethodDelete:
+		a.logouts = append(a.logouts, r.Header.Get("X-FTL-SID"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		_, _ = w.Write([]byte(`{"blocked":["ads.example.com"]}`))
+	}
+}
+
+func (a *authRecorder) recorded() ([]string, []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.passwords...), append([]string(nil), a.logouts...)
+}
+
+// TestReconcile tests that kept targets are updated in place, and others added or removed
+func TestReconcile(t *testing.T) {
+	recorder := &authRecorder{}
+	stub := httptest.NewServer(recorder)
+	defer stub.Close()
+
+	envConfig := &config.EnvConfig{Timeout: time.Second}
+	kept := piholetest.Config(t, stub, "127.0.0.1", "first")
+	removedConfig := piholetest.Config(t, stub, "localhost", "secret")
+	current, removed := pihole.Reconcile(nil, []config.Config{kept, removedConfig}, envConfig)
+	require.Len(t, current, 2)
+	assert.Empty(t, removed)
+
+	blocked, err := current[0].GetRecentBlocked(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ads.example.com"}, blocked)
+
+	kept.PIHolePassword = "second"
+	added := piholetest.Config(t, stub, "localhost", "secret")
+	added.PIHoleProtocol = "https"
+	clients, removed := pihole.Reconcile(current, []config.Config{kept, added}, envConfig)
+
+	require.Len(t, clients, 2)
+	assert.Same(t, current[0], clients[0], "kept target must reuse its client")
+	assert.Equal(t, "localhost", clients[1].GetHostname())
+	assert.NotSame(t, current[1], clients[1])
+	assert.Equal(t, []*pihole.Client{current[1]}, removed)
+
+	// The password change closed the previous session and opens a new one.
+	_, err = clients[0].GetRecentBlocked(context.Background(), 1)
+	require.NoError(t, err)
+	passwords, logouts := recorder.recorded()
+	assert.Equal(t, []string{"first", "second"}, passwords)
+	assert.Equal(t, []string{"sid1"}, logouts)
+
+	// Changing the timeout recreates every client.
+	envConfig = &config.EnvConfig{Timeout: 2 * time.Second}
+	recreated, removed := pihole.Reconcile(clients, []config.Config{kept, added}, envConfig)
+	assert.Len(t, recreated, 2)
+	assert.ElementsMatch(t, clients, removed)
+}
+
+// TestClose_Logout tests that closing a client logs its session out
+func TestClose_Logout(t *testing.T) {
+	recorder := &authRecorder{}
+	stub := httptest.NewServer(recorder)
+	defer stub.Close()
+
+	cfg := piholetest.Config(t, stub, "127.0.0.1", "secret")
+	client := pihole.NewClient(&cfg, &config.EnvConfig{Timeout: time.Second})
+	_, err := client.GetRecentBlocked(context.Background(), 1)
+	require.NoError(t, err)
+
+	client.Close()
+	_, logouts := recorder.recorded()
+	assert.Equal(t, []string{"sid1"}, logouts)
+
+	// Without open session, there is nothing to log out.
+	client.Close()
+	_, logouts = recorder.recorded()
+	assert.Len(t, logouts, 1)
+}
@@ -0,0 +1,109 @@
+package pihole
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+)
+
+const (
+	// queryPageSize is the number of queries requested at once from the
+	// query log, and maxQueryPages bounds the requests of a collection.
+	queryPageSize = 1000
+	maxQueryPages = 50
+)
+
+// Query is an entry of the Pi-hole query log.
+type Query struct {
+	ID   int     `json:"id"`
+	Time float64 `json:"time"`
+	Type string  `json:"type"`
+	// Upstream is the destination the query was forwarded to, such as
+	// 1.1.1.1#53, nil when it was not forwarded.
+	Upstream *string `json:"upstream"`
+	Reply    struct {
+		Type string `json:"type"`
+		// Time is the time the reply took in seconds, negative when unknown.
+		Time float64 `json:"time"`
+	} `json:"reply"`
+}
+
+type Queries struct {
+	Queries         []Query `json:"queries"`
+	RecordsFiltered int     `json:"recordsFiltered"`
+	Took            float64 `json:"took"`
+}
+
+// queryCursor is the position of the collections in the query log.
+type queryCursor struct {
+	// until is the end of the last window read, in Unix seconds, and lastID
+	// the newest query seen, the windows overlapping by a second.
+	until  int64
+	lastID int
+}
+
+// observeReplyTimes observes the reply time of the queries forwarded since the
+// previous collection in the upstream reply time histograms. The first
+// collection only starts reading the query log. A failure is not fatal to the
+// collection, the queries are read again by the next one.
+func (c *Client) observeReplyTimes(ctx context.Context) {
+	if metrics.UpstreamReplyTime == nil {
+		return
+	}
+
+	until := time.Now().Unix()
+	c.mu.Lock()
+	cursor := c.queryCursor
+	c.mu.Unlock()
+	if cursor.until == 0 {
+		c.mu.Lock()
+		c.queryCursor.until = until
+		c.mu.Unlock()
+		return
+	}
+
+	type observation struct {
+		upstream, queryType string
+		seconds             float64
+	}
+	var observations []observation
+	lastID := cursor.lastID
+	for page := 0; ; page++ {
+		if page == maxQueryPages {
+			c.logger().Warnf("More than %d queries since the previous collection, the reply times of the others are not observed", maxQueryPages*queryPageSize)
+			break
+		}
+
+		var queries Queries
+		endpoint := fmt.Sprintf("/api/queries?from=%d&until=%d&start=%d&length=%d", cursor.until, until, page*queryPageSize, queryPageSize)
+		if err := c.apiClient.FetchData(ctx, endpoint, &queries); err != nil {
+			c.logger().Warnf("Unable to read the query log, the reply times are not observed: %v", err)
+			return
+		}
+
+		for _, query := range queries.Queries {
+			lastID = max(lastID, query.ID)
+			if query.ID <= cursor.lastID || query.Upstream == nil || query.Reply.Time < 0 {
+				continue
+			}
+			observations = append(observations, observation{*query.Upstream, query.Type, query.Reply.Time})
+		}
+
+		if len(queries.Queries) < queryPageSize || (page+1)*queryPageSize >= queries.RecordsFiltered {
+			break
+		}
+	}
+
+	// The reply times are only observed once the whole window is read, so
+	// that a window read again is not observed twice.
+	hostname := c.GetHostname()
+	for _, o := range observations {
+		metrics.UpstreamReplyTime.WithLabelValues(hostname, o.upstream, o.queryType).Observe(o.seconds)
+	}
+
+	c.mu.Lock()
+	c.queryCursor = queryCursor{until: until, lastID: lastID}
+	c.mu.Unlock()
+}
@@ -0,0 +1,126 @@
+package pihole_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+const queriesJSON = `{"queries":[
+	{"id":3,"time":1700000002.5,"type":"AAAA","upstream":"9.9.9.9#53","reply":{"type":"IP","time":0.2}},
+	{"id":2,"time":1700000001.5,"type":"A","upstream":null,"reply":{"type":"IP","time":0.0001}},
+	{"id":1,"time":1700000000.5,"type":"A","upstream":"1.1.1.1#53","reply":{"type":"IP","time":0.02}}],
+	"recordsFiltered":3}`
+
+// queryLog is a fake Pi-hole API recording the requests made to the query log.
+type queryLog struct {
+	mu       sync.Mutex
+	requests []string
+	failing  bool
+}
+
+func (q *queryLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/auth":
+		_, _ = w.Write([]byte(`{"session":{"valid":true,"sid":"sid","validity":300}}`))
+	case "/api/queries":
+		q.mu.Lock()
+		q.requests = append(q.requests, r.URL.RawQuery)
+		failing := q.failing
+		q.mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(queriesJSON))
+	default:
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// replyTimeCounts returns the number of reply times observed by upstream and query type.
+func replyTimeCounts(t *testing.T, registry *prometheus.Registry) map[string]uint64 {
+	t.Helper()
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	counts := map[string]uint64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["upstream"]+" "+labels["query_type"]] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return counts
+}
+
+// TestCollect_ReplyTimes tests that the reply times of the forwarded queries are observed once each
+func TestCollect_ReplyTimes(t *testing.T) {
+	metrics.InitReplyTime(config.DefaultReplyTimeBuckets, 0)
+	t.Cleanup(func() { prometheus.Unregister(metrics.UpstreamReplyTime) })
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.UpstreamReplyTime)
+
+	recorder := &queryLog{}
+	stub := httptest.NewServer(recorder)
+	defer stub.Close()
+
+	cfg := piholetest.Config(t, stub, "127.0.0.1", "secret")
+	client := pihole.NewClient(&cfg, &config.EnvConfig{Timeout: time.Second, ReplyTimeHistograms: true})
+	defer client.Close()
+
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	assert.Empty(t, recorder.requests, "the first collection only starts reading the query log")
+	assert.Empty(t, replyTimeCounts(t, registry))
+
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	require.Len(t, recorder.requests, 1)
+	assert.Contains(t, recorder.requests[0], "start=0&length=1000")
+	assert.Equal(t, map[string]uint64{"9.9.9.9#53 AAAA": 1, "1.1.1.1#53 A": 1}, replyTimeCounts(t, registry))
+
+	// The queries already seen are not observed again.
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	assert.Equal(t, map[string]uint64{"9.9.9.9#53 AAAA": 1, "1.1.1.1#53 A": 1}, replyTimeCounts(t, registry))
+
+	// A query log which cannot be read does not fail the collection.
+	recorder.mu.Lock()
+	recorder.failing = true
+	recorder.mu.Unlock()
+	require.NoError(t, client.CollectMetrics(context.Background()))
+
+	metrics.DeleteHostname("127.0.0.1")
+	assert.Empty(t, replyTimeCounts(t, registry))
+}
+
+// TestCollect_ReplyTimesNotRegistered tests that a client enabling the histograms after startup, on reload, does not observe them
+func TestCollect_ReplyTimesNotRegistered(t *testing.T) {
+	previous := metrics.UpstreamReplyTime
+	metrics.UpstreamReplyTime = nil
+	t.Cleanup(func() { metrics.UpstreamReplyTime = previous })
+
+	recorder := &queryLog{}
+	stub := httptest.NewServer(recorder)
+	defer stub.Close()
+
+	cfg := piholetest.Config(t, stub, "127.0.0.1", "secret")
+	client := pihole.NewClient(&cfg, &config.EnvConfig{Timeout: time.Second, ReplyTimeHistograms: true})
+	defer client.Close()
+
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	require.NoError(t, client.CollectMetrics(context.Background()))
+	assert.Empty(t, recorder.requests)
+}
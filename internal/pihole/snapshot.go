@@ -0,0 +1,211 @@
+package pihole
+
+import (
+	"sort"
+	"time"
+)
+
+// SnapshotSchemaVersion is the version of the Snapshot JSON schema. Fields may
+// be added within a version, while renamed or removed fields bump it.
+const SnapshotSchemaVersion = 1
+
+// Snapshot is the normalized state of a Pi-hole instance at its last
+// successful collection, independent of the FTL API responses.
+type Snapshot struct {
+	SchemaVersion int             `json:"schema_version"`
+	Target        string          `json:"target"`
+	CollectedAt   time.Time       `json:"collected_at"`
+	Summary       Summary         `json:"summary"`
+	Blocking      Blocking        `json:"blocking"`
+	TopLists      TopLists        `json:"top_lists"`
+	Upstreams     []UpstreamStats `json:"upstreams"`
+	// Versions is nil until the version of the instance is detected.
+	Versions *Versions `json:"versions,omitempty"`
+}
+
+// Summary is the query and client statistics of the last 24 hours.
+type Summary struct {
+	QueriesTotal     int     `json:"queries_total"`
+	QueriesBlocked   int     `json:"queries_blocked"`
+	PercentBlocked   float64 `json:"percent_blocked"`
+	QueriesForwarded int     `json:"queries_forwarded"`
+	QueriesCached    int     `json:"queries_cached"`
+	UniqueDomains    int     `json:"unique_domains"`
+	// QueriesPerSecond is the query frequency over the last minutes.
+	QueriesPerSecond float64 `json:"queries_per_second"`
+	ClientsActive    int     `json:"clients_active"`
+	ClientsTotal     int     `json:"clients_total"`
+	// DomainsOnBlocklists is the number of domains of the gravity database,
+	// last updated at GravityUpdatedAt.
+	DomainsOnBlocklists int                `json:"domains_on_blocklists"`
+	GravityUpdatedAt    *time.Time         `json:"gravity_updated_at,omitempty"`
+	QueryTypes          map[string]float64 `json:"query_types"`
+	// Replies counts the queries by reply type, with the reply labels of the
+	// pihole_reply metric.
+	Replies map[string]int `json:"replies"`
+}
+
+// Blocking is the blocking state of an instance.
+type Blocking struct {
+	// State is one of BlockingStates.
+	State string `json:"state"`
+	// TimerSeconds is the time left before the state is reverted, omitted
+	// when no timer is running.
+	TimerSeconds *float64 `json:"timer_seconds,omitempty"`
+}
+
+// TopLists holds the top lists requested from an instance, empty when
+// disabled.
+type TopLists struct {
+	Queries        []DomainCount       `json:"queries"`
+	Ads            []DomainCount       `json:"ads"`
+	Sources        []ClientCount       `json:"sources"`
+	SourcesBlocked []ClientCount       `json:"sources_blocked"`
+	ClientAds      []ClientDomainCount `json:"client_ads"`
+}
+
+// DomainCount is an entry of a top domains list.
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Count  int    `json:"count"`
+}
+
+// ClientCount is an entry of a top clients list.
+type ClientCount struct {
+	IP    string `json:"ip"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// ClientDomainCount is the top blocked domains of a client.
+type ClientDomainCount struct {
+	IP      string        `json:"ip"`
+	Name    string        `json:"name"`
+	Domains []DomainCount `json:"domains"`
+}
+
+// UpstreamStats is the statistics of an upstream server, or of the cache and
+// blocklist pseudo destinations reported by FTL.
+type UpstreamStats struct {
+	IP                      string  `json:"ip"`
+	Name                    string  `json:"name"`
+	Port                    int     `json:"port"`
+	Queries                 int     `json:"queries"`
+	ResponseTimeSeconds     float64 `json:"response_time_seconds"`
+	ResponseVarianceSeconds float64 `json:"response_variance_seconds"`
+}
+
+// Versions is the version of each Pi-hole component.
+type Versions struct {
+	Core string `json:"core"`
+	Web  string `json:"web"`
+	FTL  string `json:"ftl"`
+}
+
+// NewSnapshot normalizes the statistics collected from target at the given
+// time, with the detected versions if any.
+func NewSnapshot(target string, stats *Statistics, version *Version, collectedAt time.Time) *Snapshot {
+	summary := stats.Summary
+	replies := summary.Queries.Replies
+	snapshot := &Snapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Target:        target,
+		CollectedAt:   collectedAt,
+		Summary: Summary{
+			QueriesTotal:        summary.Queries.Total,
+			QueriesBlocked:      summary.Queries.Blocked,
+			PercentBlocked:      summary.Queries.PercentBlocked,
+			QueriesForwarded:    summary.Queries.Forwarded,
+			QueriesCached:       summary.Queries.Cached,
+			UniqueDomains:       summary.Queries.UniqueDomains,
+			QueriesPerSecond:    summary.Queries.Frequency,
+			ClientsActive:       summary.Clients.Active,
+			ClientsTotal:        summary.Clients.Total,
+			DomainsOnBlocklists: summary.Gravity.DomainsBeingBlocked,
+			QueryTypes:          summary.Queries.Types,
+			Replies: map[string]int{
+				"unknown":   replies.UNKNOWN,
+				"no_data":   replies.NODATA,
+				"nx_domain": replies.NXDOMAIN,
+				"cname":     replies.CNAME,
+				"ip":        replies.IP,
+				"domain":    replies.DOMAIN,
+				"rr_name":   replies.RRNAME,
+				"serv_fail": replies.SERVFAIL,
+				"refused":   replies.REFUSED,
+				"not_imp":   replies.NOTIMP,
+				"other":     replies.OTHER,
+				"dnssec":    replies.DNSSEC,
+				"none":      replies.NONE,
+				"blob":      replies.BLOB,
+			},
+		},
+		Blocking: Blocking{State: stats.BlockingStatus.State()},
+		TopLists: TopLists{
+			Queries:        domainCounts(stats.PermittedDomains),
+			Ads:            domainCounts(stats.BlockedDomains),
+			Sources:        clientCounts(stats.PermittedClients),
+			SourcesBlocked: clientCounts(stats.BlockedClients),
+			ClientAds:      make([]ClientDomainCount, 0, len(stats.ClientAds)),
+		},
+		Upstreams: make([]UpstreamStats, 0, len(stats.Upstreams.Upstreams)),
+	}
+	if snapshot.Summary.QueryTypes == nil {
+		snapshot.Summary.QueryTypes = map[string]float64{}
+	}
+	if summary.Gravity.LastUpdate > 0 {
+		updatedAt := time.Unix(int64(summary.Gravity.LastUpdate), 0).UTC()
+		snapshot.Summary.GravityUpdatedAt = &updatedAt
+	}
+	if timer := stats.BlockingStatus.TimerSeconds(); timer > 0 {
+		snapshot.Blocking.TimerSeconds = &timer
+	}
+
+	for _, clientAds := range stats.ClientAds {
+		snapshot.TopLists.ClientAds = append(snapshot.TopLists.ClientAds, ClientDomainCount{
+			IP:      clientAds.Client.IP,
+			Name:    clientAds.Client.Name,
+			Domains: domainCounts(clientAds.Domains),
+		})
+	}
+
+	for _, upstream := range stats.Upstreams.Upstreams {
+		snapshot.Upstreams = append(snapshot.Upstreams, UpstreamStats{
+			IP:                      upstream.IP,
+			Name:                    upstream.Name,
+			Port:                    upstream.Port,
+			Queries:                 upstream.Count,
+			ResponseTimeSeconds:     upstream.Statistics.Response,
+			ResponseVarianceSeconds: upstream.Statistics.Variance,
+		})
+	}
+	// The most used upstreams first, as the dashboards list them.
+	sort.SliceStable(snapshot.Upstreams, func(i, j int) bool {
+		return snapshot.Upstreams[i].Queries > snapshot.Upstreams[j].Queries
+	})
+
+	if version != nil {
+		snapshot.Versions = &Versions{
+			Core: version.Version.Core.Local.Version,
+			Web:  version.Version.Web.Local.Version,
+			FTL:  version.Version.FTL.Local.Version,
+		}
+	}
+	return snapshot
+}
+
+func domainCounts(domains TopDomains) []DomainCount {
+	result := make([]DomainCount, 0, len(domains.Domains))
+	for _, domain := range domains.Domains {
+		result = append(result, DomainCount{Domain: domain.Domain, Count: domain.Count})
+	}
+	return result
+}
+
+func clientCounts(clients []PiHoleClient) []ClientCount {
+	result := make([]ClientCount, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, ClientCount{IP: client.IP, Name: client.Name, Count: client.Count})
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is a push request rejected by the receiver with a non-2xx
+// status code.
+type StatusError struct {
+	// Operation describes the request, such as "InfluxDB write".
+	Operation  string
+	StatusCode int
+	// Message is the start of the response body.
+	Message string
+	// RetryAfter is the delay requested in the Retry-After header, 0 without
+	// one.
+	RetryAfter time.Duration
+}
+
+// NewStatusError returns the error of a response rejected by the receiver,
+// reading the start of its body.
+func NewStatusError(operation string, resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := &StatusError{
+		Operation:  operation,
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+	}
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed with status code %d: %s", e.Operation, e.StatusCode, e.Message)
+}
+
+// IsRetryable tells whether a push may succeed later: network errors, rate
+// limiting and server errors are, while the rejected requests are not.
+func IsRetryable(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+}
+
+// RetryAfter returns the delay requested by the receiver before the next
+// attempt, 0 when it did not request one.
+func RetryAfter(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,33 @@
+package push_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eko/pihole-exporter/internal/push"
+)
+
+func TestNewStatusError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("Retry-After", "5")
+	recorder.WriteHeader(http.StatusTooManyRequests)
+	_, _ = recorder.WriteString(" slow down\n")
+
+	err := push.NewStatusError("remote write", recorder.Result())
+	assert.EqualError(t, err, "remote write failed with status code 429: slow down")
+	assert.Equal(t, 5*time.Second, push.RetryAfter(fmt.Errorf("wrapped: %w", err)))
+	assert.Zero(t, push.RetryAfter(errors.New("connection refused")))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, push.IsRetryable(errors.New("connection refused")))
+	assert.True(t, push.IsRetryable(&push.StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, push.IsRetryable(&push.StatusError{StatusCode: http.StatusServiceUnavailable}))
+	assert.False(t, push.IsRetryable(&push.StatusError{StatusCode: http.StatusBadRequest}))
+}
@@ -0,0 +1,74 @@
+package push
+
+import (
+	"math"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Sample is a single value of a series, as exposed in the Prometheus text
+// format.
+type Sample struct {
+	// Name is the name of the series, with the _bucket, _sum or _count
+	// suffix of histograms and summaries.
+	Name string
+	// Labels are the labels of the series, including the le label of
+	// histogram buckets and the quantile label of summaries.
+	Labels []*dto.LabelPair
+	Value  float64
+}
+
+// Flatten converts the metric families into samples, splitting histograms into
+// their _bucket, _sum and _count series and summaries into their quantile,
+// _sum and _count ones, as Prometheus does when scraping them.
+func Flatten(families []*dto.MetricFamily) []Sample {
+	var samples []Sample
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			labels := m.GetLabel()
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				samples = append(samples, Sample{Name: name, Labels: labels, Value: m.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				samples = append(samples, Sample{Name: name, Labels: labels, Value: m.GetGauge().GetValue()})
+			case dto.MetricType_UNTYPED:
+				samples = append(samples, Sample{Name: name, Labels: labels, Value: m.GetUntyped().GetValue()})
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				buckets := h.GetBucket()
+				for _, b := range buckets {
+					le := strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)
+					samples = append(samples, Sample{Name: name + "_bucket", Labels: withLabel(labels, "le", le), Value: float64(b.GetCumulativeCount())})
+				}
+				// The +Inf bucket is implicit in the gathered histograms.
+				if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].GetUpperBound(), 1) {
+					samples = append(samples, Sample{Name: name + "_bucket", Labels: withLabel(labels, "le", "+Inf"), Value: float64(h.GetSampleCount())})
+				}
+				samples = append(samples,
+					Sample{Name: name + "_sum", Labels: labels, Value: h.GetSampleSum()},
+					Sample{Name: name + "_count", Labels: labels, Value: float64(h.GetSampleCount())},
+				)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					quantile := strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+					samples = append(samples, Sample{Name: name, Labels: withLabel(labels, "quantile", quantile), Value: q.GetValue()})
+				}
+				samples = append(samples,
+					Sample{Name: name + "_sum", Labels: labels, Value: s.GetSampleSum()},
+					Sample{Name: name + "_count", Labels: labels, Value: float64(s.GetSampleCount())},
+				)
+			}
+		}
+	}
+	return samples
+}
+
+// withLabel returns a copy of labels with an additional label.
+func withLabel(labels []*dto.LabelPair, name, value string) []*dto.LabelPair {
+	result := make([]*dto.LabelPair, len(labels), len(labels)+1)
+	copy(result, labels)
+	return append(result, &dto.LabelPair{Name: &name, Value: &value})
+}
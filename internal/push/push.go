@@ -0,0 +1,103 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sink receives the metrics gathered after each collection, such as a
+// time series database the exporter pushes to.
+type Sink interface {
+	// Name identifies the sink in the logs and the exporter metrics.
+	Name() string
+	// Push sends the metric families gathered at the given time.
+	Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error
+}
+
+// Flusher is implemented by the sinks sending the pushed metrics in the
+// background.
+type Flusher interface {
+	// Flush waits until the metrics pushed so far are sent, or ctx is done.
+	Flush(ctx context.Context) error
+}
+
+// Run collects the metrics every interval and pushes them to the sinks, until
+// ctx is done. Each collection and push is given timeout to end. The sinks
+// implementing io.Closer are closed once done.
+func Run(ctx context.Context, interval, timeout time.Duration, collect func(context.Context), gatherer prometheus.Gatherer, sinks ...Sink) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer Close(sinks...)
+
+	for {
+		// The failed pushes are logged, they are attempted again next time.
+		_ = Once(ctx, timeout, collect, gatherer, sinks...)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the sinks implementing io.Closer, logging the failures.
+func Close(sinks ...Sink) {
+	for _, sink := range sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.WithField("sink", sink.Name()).Warnf("Failed to close sink: %v", err)
+			}
+		}
+	}
+}
+
+// Flush waits for the sinks implementing Flusher to send the metrics pushed so
+// far, returning the errors of the sinks which did not.
+func Flush(ctx context.Context, sinks ...Sink) error {
+	var errs []error
+	for _, sink := range sinks {
+		if flusher, ok := sink.(Flusher); ok {
+			if err := flusher.Flush(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Once collects the metrics and pushes them to the sinks a single time,
+// returning the errors of the sinks the push failed to. The collection, and
+// each push, are given timeout to end, so that a sink which is down does not
+// hold the others back.
+func Once(ctx context.Context, timeout time.Duration, collect func(context.Context), gatherer prometheus.Gatherer, sinks ...Sink) error {
+	collectCtx, cancel := context.WithTimeout(ctx, timeout)
+	collect(collectCtx)
+	cancel()
+
+	timestamp := time.Now()
+	families, err := gatherer.Gather()
+	if err != nil {
+		// The families gathered without error are pushed anyway.
+		log.Warnf("An error occurred while gathering metrics to push: %v", err)
+	}
+
+	var errs []error
+	for _, sink := range sinks {
+		pushCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := sink.Push(pushCtx, families, timestamp)
+		cancel()
+		if err != nil {
+			log.WithField("sink", sink.Name()).Errorf("Failed to push metrics: %v", err)
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
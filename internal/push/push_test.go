@@ -0,0 +1,130 @@
+package push_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/internal/push"
+)
+
+// sinkRecorder is a sink recording the pushed metric families.
+type sinkRecorder struct {
+	mu     sync.Mutex
+	pushes [][]*dto.MetricFamily
+}
+
+func (s *sinkRecorder) Name() string {
+	return "recorder"
+}
+
+func (s *sinkRecorder) Push(_ context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushes = append(s.pushes, families)
+	return nil
+}
+
+// failingSink is a sink failing every push.
+type failingSink struct{}
+
+func (failingSink) Name() string {
+	return "failing"
+}
+
+func (failingSink) Push(context.Context, []*dto.MetricFamily, time.Time) error {
+	return errors.New("unavailable")
+}
+
+// Flush implements push.Flusher, failing like the pushes.
+func (failingSink) Flush(context.Context) error {
+	return errors.New("not sent")
+}
+
+// blockingSink is a sink whose pushes only end with their context.
+type blockingSink struct{}
+
+func (blockingSink) Name() string {
+	return "blocking"
+}
+
+func (blockingSink) Push(ctx context.Context, _ []*dto.MetricFamily, _ time.Time) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *sinkRecorder) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pushes)
+}
+
+// TestRun tests that the metrics are collected then pushed every interval until the context is done
+func TestRun(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "pihole_status"})
+	registry.MustRegister(gauge)
+
+	var collections int
+	collect := func(ctx context.Context) {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline, "a collection must be given a timeout")
+		collections++
+		gauge.Set(float64(collections))
+	}
+
+	sink := &sinkRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		push.Run(ctx, 10*time.Millisecond, time.Second, collect, registry, sink)
+	}()
+
+	require.Eventually(t, func() bool { return sink.count() >= 2 }, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	assert.Equal(t, collections, len(sink.pushes))
+	assert.Equal(t, 1.0, sink.pushes[0][0].GetMetric()[0].GetGauge().GetValue())
+	assert.Equal(t, 2.0, sink.pushes[1][0].GetMetric()[0].GetGauge().GetValue())
+}
+
+// TestOnce tests that the metrics are pushed to every sink and the failed pushes returned
+func TestOnce(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "pihole_status"}))
+
+	var collected bool
+	sink := &sinkRecorder{}
+	err := push.Once(context.Background(), time.Second, func(context.Context) { collected = true }, registry, failingSink{}, sink)
+	assert.EqualError(t, err, "failing: unavailable")
+	assert.True(t, collected)
+	assert.Equal(t, 1, sink.count(), "the other sinks must be pushed to")
+
+	assert.NoError(t, push.Once(context.Background(), time.Second, func(context.Context) {}, registry, sink))
+}
+
+// TestOnce_Timeout tests that a blocking sink is given up on after the timeout
+func TestOnce_Timeout(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	sink := &sinkRecorder{}
+	err := push.Once(context.Background(), 50*time.Millisecond, func(context.Context) {}, registry, blockingSink{}, sink)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, sink.count(), "the other sinks must be pushed to")
+}
+
+// TestFlush tests that the sinks sending in the background are flushed
+func TestFlush(t *testing.T) {
+	assert.NoError(t, push.Flush(context.Background(), &sinkRecorder{}))
+	assert.EqualError(t, push.Flush(context.Background(), &sinkRecorder{}, failingSink{}), "failing: not sent")
+}
@@ -0,0 +1,95 @@
+package pushgateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// hostnameLabel is the label of the Pi-hole metrics holding the target, used as
+// grouping key.
+const hostnameLabel = "hostname"
+
+// Pusher pushes the metrics to a Pushgateway, for the hosts running the
+// exporter as a cron job rather than a daemon. The metrics of each Pi-hole
+// target are pushed to their own group, with the job and hostname grouping
+// keys, and replace the ones of the previous push.
+type Pusher struct {
+	url    string
+	job    string
+	client *http.Client
+}
+
+// NewPusher returns a Pusher to the Pushgateway at url, such as
+// http://pushgateway:9091.
+func NewPusher(url, job string, timeout time.Duration) *Pusher {
+	return &Pusher{url: url, job: job, client: &http.Client{Timeout: timeout}}
+}
+
+// Name implements push.Sink.
+func (p *Pusher) Name() string {
+	return "pushgateway"
+}
+
+// Push implements push.Sink. The Pushgateway sets the push time itself, the
+// timestamp is ignored.
+func (p *Pusher) Push(ctx context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	byHostname := groupByHostname(families)
+	hostnames := make([]string, 0, len(byHostname))
+	for hostname := range byHostname {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	var errs []error
+	for _, hostname := range hostnames {
+		group := byHostname[hostname]
+		pusher := push.New(p.url, p.job).
+			Client(p.client).
+			Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return group, nil }))
+		// The series without target are pushed to the group of the job.
+		if hostname != "" {
+			pusher = pusher.Grouping(hostnameLabel, hostname)
+		}
+		if err := pusher.PushContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to push metrics of %s: %w", hostname, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// groupByHostname splits the metric families by the hostname label of their
+// series, which is removed as the Pushgateway adds the grouping keys back.
+func groupByHostname(families []*dto.MetricFamily) map[string][]*dto.MetricFamily {
+	result := make(map[string][]*dto.MetricFamily)
+	for _, family := range families {
+		byHostname := make(map[string]*dto.MetricFamily)
+		for _, metric := range family.GetMetric() {
+			var hostname string
+			m := &dto.Metric{Gauge: metric.Gauge, Counter: metric.Counter, Summary: metric.Summary, Untyped: metric.Untyped, Histogram: metric.Histogram}
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == hostnameLabel {
+					hostname = label.GetValue()
+				} else {
+					m.Label = append(m.Label, label)
+				}
+			}
+
+			group, found := byHostname[hostname]
+			if !found {
+				group = &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type, Unit: family.Unit}
+				byHostname[hostname] = group
+				result[hostname] = append(result[hostname], group)
+			}
+			group.Metric = append(group.Metric, m)
+		}
+	}
+	return result
+}
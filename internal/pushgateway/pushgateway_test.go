@@ -0,0 +1,68 @@
+package pushgateway_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/internal/pushgateway"
+)
+
+// TestPush tests that the metrics of each target are pushed to their own group, without the hostname label
+func TestPush(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, http.MethodPut, r.Method)
+		body, _ := io.ReadAll(r.Body)
+		bodies[r.URL.Path] = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_status"}, []string{"hostname"})
+	registry.MustRegister(gauge)
+	gauge.WithLabelValues("pi1.lan").Set(1)
+	gauge.WithLabelValues("pi2.lan").Set(0)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	pusher := pushgateway.NewPusher(server.URL, "pihole", time.Second)
+	require.NoError(t, pusher.Push(context.Background(), families, time.Now()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, bodies, 2)
+	for path := range bodies {
+		assert.Contains(t, []string{"/metrics/job/pihole/hostname/pi1.lan", "/metrics/job/pihole/hostname/pi2.lan"}, path)
+		assert.NotContains(t, bodies[path], "pi1.lan")
+		assert.NotContains(t, bodies[path], "pi2.lan")
+	}
+}
+
+// TestPush_Error tests that the rejected pushes are returned
+func TestPush_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "pihole_exporter_up"}))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	pusher := pushgateway.NewPusher(server.URL, "pihole", time.Second)
+	assert.Error(t, pusher.Push(context.Background(), families, time.Now()))
+}
@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileExt is the extension of the entry files in the queue directory.
+const fileExt = ".entry"
+
+// Entry is an entry of a queue.
+type Entry struct {
+	name string
+	Data []byte
+}
+
+// Queue is a FIFO of entries, such as the requests to send to a remote
+// endpoint. Each entry is kept on disk in its own file named after its
+// creation time, so that the queue survives a restart, or in memory when the
+// queue has no directory. The oldest entries are dropped when the queue
+// exceeds its maximum size. It is safe for concurrent use.
+type Queue struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	entries []Entry
+	last    int64
+}
+
+// Open returns the queue kept in dir, with the entries left by a previous run,
+// or a queue in memory when dir is empty.
+func Open(dir string, maxBytes int64) (*Queue, error) {
+	q := &Queue{dir: dir, maxBytes: maxBytes}
+	if dir == "" {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	names, err := q.names()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queue directory: %w", err)
+		}
+		q.size += info.Size()
+	}
+	if len(names) > 0 {
+		q.last, _ = strconv.ParseInt(strings.TrimSuffix(names[len(names)-1], fileExt), 10, 64)
+	}
+	return q, nil
+}
+
+// names returns the entry files of the queue, oldest first.
+func (q *Queue) names() ([]string, error) {
+	dirEntries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	names := make([]string, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), fileExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	// The names are zero padded timestamps.
+	sort.Strings(names)
+	return names, nil
+}
+
+// Push appends an entry, dropping the oldest ones to stay within the maximum
+// size. It returns the number of dropped entries.
+func (q *Queue) Push(data []byte) (dropped int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// The names must be increasing even if the clock is not.
+	q.last = max(time.Now().UnixNano(), q.last+1)
+	name := fmt.Sprintf("%020d%s", q.last, fileExt)
+	if q.dir == "" {
+		q.entries = append(q.entries, Entry{name: name, Data: data})
+	} else {
+		// The entry is written under a temporary name first, so that a crash
+		// does not leave a truncated entry behind.
+		tmp := filepath.Join(q.dir, name+".tmp")
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			_ = os.Remove(tmp)
+			return 0, fmt.Errorf("failed to queue entry: %w", err)
+		}
+		if err := os.Rename(tmp, filepath.Join(q.dir, name)); err != nil {
+			_ = os.Remove(tmp)
+			return 0, fmt.Errorf("failed to queue entry: %w", err)
+		}
+	}
+	q.size += int64(len(data))
+
+	for q.size > q.maxBytes {
+		oldest, found, err := q.peek()
+		if err != nil || !found || oldest.name == name {
+			return dropped, err
+		}
+		if err := q.remove(oldest); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// Peek returns the oldest entry, if any, without removing it.
+func (q *Queue) Peek() (Entry, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.peek()
+}
+
+func (q *Queue) peek() (Entry, bool, error) {
+	if q.dir == "" {
+		if len(q.entries) == 0 {
+			return Entry{}, false, nil
+		}
+		return q.entries[0], true, nil
+	}
+
+	names, err := q.names()
+	if err != nil || len(names) == 0 {
+		return Entry{}, false, err
+	}
+	data, err := os.ReadFile(filepath.Join(q.dir, names[0]))
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to read queued entry: %w", err)
+	}
+	return Entry{name: names[0], Data: data}, true, nil
+}
+
+// Remove removes an entry returned by Peek.
+func (q *Queue) Remove(entry Entry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.remove(entry)
+}
+
+func (q *Queue) remove(entry Entry) error {
+	if q.dir == "" {
+		for i := range q.entries {
+			if q.entries[i].name == entry.name {
+				q.entries = append(q.entries[:i], q.entries[i+1:]...)
+				q.size -= int64(len(entry.Data))
+				break
+			}
+		}
+		return nil
+	}
+
+	path := filepath.Join(q.dir, entry.name)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove queued entry: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove queued entry: %w", err)
+	}
+	q.size -= info.Size()
+	return nil
+}
+
+// Size returns the total size of the queued entries.
+func (q *Queue) Size() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Len returns the number of queued entries.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.dir == "" {
+		return len(q.entries)
+	}
+	names, _ := q.names()
+	return len(names)
+}
@@ -0,0 +1,61 @@
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/internal/queue"
+)
+
+// TestQueue tests that the entries are returned in order, on disk and in memory,
+// and that the oldest ones are dropped when the queue is full
+func TestQueue(t *testing.T) {
+	for name, dir := range map[string]string{"disk": t.TempDir(), "memory": ""} {
+		t.Run(name, func(t *testing.T) {
+			q, err := queue.Open(dir, 10)
+			require.NoError(t, err)
+
+			for _, data := range []string{"first", "2nd", "third"} {
+				_, err := q.Push([]byte(data))
+				require.NoError(t, err)
+			}
+			assert.Equal(t, 2, q.Len(), "the first entry must be dropped")
+			assert.Equal(t, int64(8), q.Size())
+
+			for _, want := range []string{"2nd", "third"} {
+				entry, found, err := q.Peek()
+				require.NoError(t, err)
+				require.True(t, found)
+				assert.Equal(t, want, string(entry.Data))
+				require.NoError(t, q.Remove(entry))
+			}
+			_, found, err := q.Peek()
+			require.NoError(t, err)
+			assert.False(t, found)
+			assert.Zero(t, q.Size())
+		})
+	}
+}
+
+// TestQueue_Reopen tests that the entries on disk survive a restart
+func TestQueue_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := queue.Open(dir, 1024)
+	require.NoError(t, err)
+	_, err = q.Push([]byte("first"))
+	require.NoError(t, err)
+
+	q, err = queue.Open(dir, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), q.Size())
+	_, err = q.Push([]byte("second"))
+	require.NoError(t, err)
+
+	entry, found, err := q.Peek()
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "first", string(entry.Data))
+	assert.Equal(t, 2, q.Len())
+}
@@ -0,0 +1,290 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/push"
+	"github.com/eko/pihole-exporter/internal/queue"
+)
+
+const (
+	// DefaultWALMaxBytes is the maximum size of the queued requests.
+	DefaultWALMaxBytes = 64 << 20
+
+	// sinkName identifies the remote write sink in the logs and metrics.
+	sinkName = "remote_write"
+	// maxSamplesPerSend is the number of samples per request, the default of
+	// the Prometheus queue manager.
+	maxSamplesPerSend = 2000
+	// minBackoff and maxBackoff bound the wait between two attempts.
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// Options configures a Sender.
+type Options struct {
+	// URL is the remote write endpoint, such as
+	// http://prometheus:9090/api/v1/write.
+	URL string
+	// BearerToken, or else Username and Password, authenticate the requests.
+	BearerToken string
+	Username    string
+	Password    string
+	// WALPath is the directory keeping the requests until they are sent,
+	// they are kept in memory when empty.
+	WALPath     string
+	WALMaxBytes int64
+	// Timeout is the timeout of each request.
+	Timeout time.Duration
+}
+
+// Sender sends the metrics with the Prometheus remote write protocol, for the
+// sites Prometheus cannot scrape. The pushed samples are appended to a queue
+// written ahead on disk, which a background loop sends in order, retrying the
+// server and network errors with an exponential backoff. The requests not
+// sent yet survive a restart.
+type Sender struct {
+	url         string
+	bearerToken string
+	username    string
+	password    string
+	client      *http.Client
+	queue       *queue.Queue
+	// backoff is the wait after the first failed attempt, doubled for each
+	// of the next ones.
+	backoff time.Duration
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+	// sent is signaled each time a request leaves the queue.
+	sent chan struct{}
+
+	mu sync.Mutex
+	// lastErr is the error of the last failed attempt, and rejected the
+	// errors of the requests dropped since the last Flush.
+	lastErr  error
+	rejected []error
+}
+
+// NewSender returns a Sender to the remote write endpoint of opts, sending the
+// queued requests until it is closed.
+func NewSender(opts Options) (*Sender, error) {
+	maxBytes := opts.WALMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultWALMaxBytes
+	}
+	q, err := queue.Open(opts.WALPath, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	metrics.PushBufferBytes.WithLabelValues(sinkName).Set(float64(q.Size()))
+
+	s := newSender(opts, q, minBackoff)
+	s.start()
+	return s, nil
+}
+
+func newSender(opts Options, q *queue.Queue, backoff time.Duration) *Sender {
+	return &Sender{
+		url:         opts.URL,
+		bearerToken: opts.BearerToken,
+		username:    opts.Username,
+		password:    opts.Password,
+		client:      &http.Client{Timeout: opts.Timeout},
+		queue:       q,
+		backoff:     backoff,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		sent:        make(chan struct{}, 1),
+	}
+}
+
+// start sends the queued requests in the background until Close.
+func (s *Sender) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.run(ctx)
+}
+
+// Name implements push.Sink.
+func (s *Sender) Name() string {
+	return sinkName
+}
+
+// Push implements push.Sink, queueing the samples to be sent in the
+// background.
+func (s *Sender) Push(_ context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	all := newSeries(push.Flatten(families), timestamp.UnixMilli())
+
+	var errs []error
+	for start := 0; start < len(all); start += maxSamplesPerSend {
+		request := snappy.Encode(nil, marshalWriteRequest(all[start:min(start+maxSamplesPerSend, len(all))]))
+		dropped, err := s.queue.Push(request)
+		if dropped > 0 {
+			metrics.PushBatches.WithLabelValues(sinkName, "dropped").Add(float64(dropped))
+			s.logger().Warnf("Remote write queue full, %d request(s) dropped", dropped)
+		}
+		if err != nil {
+			metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+			errs = append(errs, err)
+			continue
+		}
+		metrics.PushBatches.WithLabelValues(sinkName, "buffered").Inc()
+	}
+	metrics.PushBufferBytes.WithLabelValues(sinkName).Set(float64(s.queue.Size()))
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return errors.Join(errs...)
+}
+
+// Flush implements push.Flusher, waiting until the queue is empty. It fails
+// when requests are still queued once ctx is done, or were rejected by the
+// receiver.
+func (s *Sender) Flush(ctx context.Context) error {
+	for {
+		pending := s.queue.Len()
+		if pending == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return fmt.Errorf("%d remote write request(s) not sent: %w", pending, errors.Join(ctx.Err(), s.lastErr))
+		case <-s.sent:
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := errors.Join(s.rejected...)
+	s.rejected = nil
+	return err
+}
+
+// Close stops sending, the requests still queued on disk are sent after a
+// restart.
+func (s *Sender) Close() error {
+	s.cancel()
+	<-s.done
+	if pending := s.queue.Len(); pending > 0 {
+		s.logger().Infof("%d remote write request(s) not sent yet", pending)
+	}
+	return nil
+}
+
+// run sends the queued requests, oldest first, until ctx is done.
+func (s *Sender) run(ctx context.Context) {
+	defer close(s.done)
+
+	backoff := s.backoff
+	for {
+		entry, found, err := s.queue.Peek()
+		if err != nil {
+			s.logger().Errorf("Failed to read remote write queue: %v", err)
+		}
+		if err != nil || !found {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+
+		err = s.send(ctx, entry.Data)
+		s.mu.Lock()
+		s.lastErr = err
+		if err != nil && !push.IsRetryable(err) {
+			s.rejected = append(s.rejected, err)
+		}
+		s.mu.Unlock()
+		if err != nil && push.IsRetryable(err) {
+			if ctx.Err() != nil {
+				return
+			}
+			wait := backoff
+			if retryAfter := push.RetryAfter(err); retryAfter > 0 {
+				wait = min(retryAfter, maxBackoff)
+			}
+			s.logger().Warnf("Remote write failed, retrying in %s: %v", wait, err)
+			backoff = min(backoff*2, maxBackoff)
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+
+		if err != nil {
+			metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+			s.logger().Errorf("Dropping remote write request rejected by the receiver: %v", err)
+		} else {
+			metrics.PushBatches.WithLabelValues(sinkName, "success").Inc()
+		}
+		backoff = s.backoff
+		if err := s.queue.Remove(entry); err != nil {
+			s.logger().Errorf("Failed to remove sent request from the queue: %v", err)
+		}
+		metrics.PushBufferBytes.WithLabelValues(sinkName).Set(float64(s.queue.Size()))
+		select {
+		case s.sent <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// send sends a compressed write request.
+func (s *Sender) send(ctx context.Context, request []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(request))
+	if err != nil {
+		return fmt.Errorf("failed to create remote write request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "pihole-exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	} else if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send remote write request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	return push.NewStatusError("remote write", resp)
+}
+
+func (s *Sender) logger() *log.Entry {
+	return log.WithField("sink", sinkName)
+}
@@ -0,0 +1,219 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/eko/pihole-exporter/internal/queue"
+)
+
+// receiver is a fake remote write receiver recording the received series,
+// and answering with the given status codes before accepting them.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	headers  []http.Header
+	series   []series
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.headers = append(r.headers, req.Header.Clone())
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+
+	compressed, _ := io.ReadAll(req.Body)
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.series = append(r.series, unmarshalWriteRequest(body)...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *receiver) fail(statuses ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, statuses...)
+}
+
+func (r *receiver) received() []series {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]series(nil), r.series...)
+}
+
+// unmarshalWriteRequest decodes the series of a write request, which fields
+// are all length delimited but the sample value and timestamp.
+func unmarshalWriteRequest(b []byte) []series {
+	var result []series
+	forEachField(b, func(_ protowire.Number, ts []byte) {
+		var s series
+		forEachField(ts, func(num protowire.Number, field []byte) {
+			switch num {
+			case timeSeriesLabels:
+				var l label
+				forEachField(field, func(num protowire.Number, v []byte) {
+					if num == labelName {
+						l.name = string(v)
+					} else {
+						l.value = string(v)
+					}
+				})
+				s.labels = append(s.labels, l)
+			case timeSeriesSamples:
+				value, n := protowire.ConsumeFixed64(field[1:])
+				timestamp, _ := protowire.ConsumeVarint(field[1+n+1:])
+				s.value, s.timestamp = math.Float64frombits(value), int64(timestamp)
+			}
+		})
+		result = append(result, s)
+	})
+	return result
+}
+
+func forEachField(b []byte, fn func(protowire.Number, []byte)) {
+	for len(b) > 0 {
+		num, _, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		v, n := protowire.ConsumeBytes(b)
+		b = b[n:]
+		fn(num, v)
+	}
+}
+
+func gather(t *testing.T, value float64) []*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_reply"}, []string{"type", "hostname", "empty"})
+	registry.MustRegister(gauge)
+	gauge.WithLabelValues("A", "127.0.0.1", "").Set(value)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	return families
+}
+
+func newTestSender(t *testing.T, opts Options) *Sender {
+	t.Helper()
+	q, err := queue.Open(opts.WALPath, DefaultWALMaxBytes)
+	require.NoError(t, err)
+	return newSender(opts, q, time.Millisecond)
+}
+
+// TestSender tests that the samples are sent as snappy compressed protobuf with sorted labels
+func TestSender(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	s := newTestSender(t, Options{URL: server.URL, BearerToken: "token", Timeout: time.Second})
+	s.start()
+	defer s.Close()
+	require.NoError(t, s.Push(context.Background(), gather(t, 3), time.UnixMilli(1000)))
+
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, series{
+		labels:    []label{{"__name__", "pihole_reply"}, {"hostname", "127.0.0.1"}, {"type", "A"}},
+		value:     3,
+		timestamp: 1000,
+	}, r.received()[0])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.Equal(t, "snappy", r.headers[0].Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", r.headers[0].Get("Content-Type"))
+	assert.Equal(t, "0.1.0", r.headers[0].Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, "Bearer token", r.headers[0].Get("Authorization"))
+}
+
+// TestSender_Retry tests that the server errors are retried in order and the rejected requests dropped
+func TestSender_Retry(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	r.fail(http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusBadRequest)
+	s := newTestSender(t, Options{URL: server.URL, Username: "prometheus", Password: "secret", Timeout: time.Second})
+	require.NoError(t, s.Push(context.Background(), gather(t, 1), time.UnixMilli(1000)))
+	require.NoError(t, s.Push(context.Background(), gather(t, 2), time.UnixMilli(2000)))
+	s.start()
+	defer s.Close()
+
+	// The first request is retried until rejected, the second one is sent.
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 2.0, r.received()[0].value)
+	require.Eventually(t, func() bool { return s.queue.Len() == 0 }, 5*time.Second, time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	username, password, ok := (&http.Request{Header: r.headers[0]}).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "prometheus", username)
+	assert.Equal(t, "secret", password)
+}
+
+// TestSender_WAL tests that the requests not sent yet are sent after a restart
+func TestSender_WAL(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	opts := Options{URL: server.URL, WALPath: t.TempDir(), Timeout: time.Second}
+	s := newTestSender(t, opts)
+	require.NoError(t, s.Push(context.Background(), gather(t, 1), time.UnixMilli(1000)))
+
+	s = newTestSender(t, opts)
+	require.Equal(t, 1, s.queue.Len())
+	s.start()
+	defer s.Close()
+
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int64(1000), r.received()[0].timestamp)
+}
+
+// TestSender_Flush tests that a flush waits for the queued requests and reports those not sent
+func TestSender_Flush(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	s := newTestSender(t, Options{URL: server.URL, Timeout: time.Second})
+	s.start()
+	defer s.Close()
+
+	require.NoError(t, s.Push(context.Background(), gather(t, 1), time.UnixMilli(1000)))
+	require.NoError(t, s.Flush(context.Background()))
+	assert.Len(t, r.received(), 1)
+
+	r.fail(http.StatusBadRequest)
+	require.NoError(t, s.Push(context.Background(), gather(t, 2), time.UnixMilli(2000)))
+	assert.ErrorContains(t, s.Flush(context.Background()), "400", "a rejected request must fail the flush")
+	assert.NoError(t, s.Flush(context.Background()), "the rejections are reported once")
+
+	r.fail(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+		http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	require.NoError(t, s.Push(context.Background(), gather(t, 3), time.UnixMilli(3000)))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorContains(t, s.Flush(ctx), "1 remote write request(s) not sent")
+}
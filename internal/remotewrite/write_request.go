@@ -0,0 +1,83 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/eko/pihole-exporter/internal/push"
+)
+
+// label is a label of a series, the metric name being the __name__ label.
+type label struct {
+	name, value string
+}
+
+// series is a series with a single sample, as sent each push.
+type series struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// newSeries converts the samples into remote write series with sorted labels,
+// without the empty ones as Prometheus does, at the given timestamp in
+// milliseconds.
+func newSeries(samples []push.Sample, timestamp int64) []series {
+	result := make([]series, 0, len(samples))
+	for _, sample := range samples {
+		labels := make([]label, 0, len(sample.Labels)+1)
+		labels = append(labels, label{name: "__name__", value: sample.Name})
+		for _, l := range sample.Labels {
+			if l.GetValue() != "" {
+				labels = append(labels, label{name: l.GetName(), value: l.GetValue()})
+			}
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+		result = append(result, series{labels: labels, value: sample.Value, timestamp: timestamp})
+	}
+	return result
+}
+
+// Field numbers of the remote write 1.0 protobuf messages, see
+// https://prometheus.io/docs/specs/prw/remote_write_spec/.
+const (
+	writeRequestTimeseries = 1
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+)
+
+// marshalWriteRequest encodes a prometheus.WriteRequest message with the series.
+func marshalWriteRequest(series []series) []byte {
+	var b []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, labelName, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, labelValue, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+
+			ts = protowire.AppendTag(ts, timeSeriesLabels, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+
+		var sb []byte
+		sb = protowire.AppendTag(sb, sampleValue, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+		sb = protowire.AppendTag(sb, sampleTimestamp, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, timeSeriesSamples, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sb)
+
+		b = protowire.AppendTag(b, writeRequestTimeseries, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	return b
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+// TargetsResponse is the body returned by the targets endpoint.
+type TargetsResponse struct {
+	SchemaVersion int      `json:"schema_version"`
+	Targets       []Target `json:"targets"`
+}
+
+// Target describes a Pi-hole target and its last collection.
+type Target struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Status is the result of the last collection: success, error or
+	// timeout, or pending before the first one.
+	Status             string     `json:"status"`
+	LastCollection     *time.Time `json:"last_collection,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+	LastErrorTime      *time.Time `json:"last_error_time,omitempty"`
+	SnapshotCollection *time.Time `json:"snapshot_collected_at,omitempty"`
+	SnapshotPath       string     `json:"snapshot_path"`
+}
+
+// apiError is the body returned by the API endpoints on error.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// targetsHandler lists the Pi-hole targets with the state of their last
+// collection, in the configuration order.
+func (s *Server) targetsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		clients := s.Clients()
+		response := TargetsResponse{SchemaVersion: pihole.SnapshotSchemaVersion, Targets: make([]Target, 0, len(clients))}
+		for _, client := range clients {
+			response.Targets = append(response.Targets, newTarget(client))
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+func newTarget(client *pihole.Client) Target {
+	state := client.LastScrape()
+	target := Target{
+		Name:         client.GetHostname(),
+		URL:          client.GetBaseURL(),
+		Status:       "pending",
+		SnapshotPath: fmt.Sprintf("/api/v1/targets/%s/snapshot", url.PathEscape(client.GetHostname())),
+	}
+	if state.Status != nil {
+		switch state.Status.Status {
+		case pihole.MetricsCollectionSuccess:
+			target.Status = "success"
+		case pihole.MetricsCollectionTimeout:
+			target.Status = "timeout"
+		default:
+			target.Status = "error"
+		}
+		target.LastCollection = &state.Time
+	}
+	if state.LastError != nil {
+		target.LastError = state.LastError.Error()
+		target.LastErrorTime = &state.LastErrorTime
+	}
+	if snapshot := client.Snapshot(); snapshot != nil {
+		target.SnapshotCollection = &snapshot.CollectedAt
+	}
+	return target
+}
+
+// snapshotHandler returns the snapshot of the last successful collection of
+// a target. It never collects, a target not collected yet is unavailable.
+func (s *Server) snapshotHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		name := req.PathValue("name")
+		var client *pihole.Client
+		for _, c := range s.Clients() {
+			if c.GetHostname() == name {
+				client = c
+				break
+			}
+		}
+		if client == nil {
+			writeJSON(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("unknown target %s", name)})
+			return
+		}
+
+		snapshot := client.Snapshot()
+		if snapshot == nil {
+			writeJSON(w, http.StatusServiceUnavailable, apiError{Error: fmt.Sprintf("%s not collected yet", name)})
+			return
+		}
+		writeJSON(w, http.StatusOK, snapshot)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Warnf("Failed to write API response: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+// TestTargets tests that the targets are listed with the result of their last collection
+func TestTargets(t *testing.T) {
+	envConfig := testEnvConfig()
+	healthy := piholetest.NewServer(t, healthyResponses())
+	broken := piholetest.NewServer(t, map[string]any{})
+	clients := []*pihole.Client{
+		piholetest.NewClient(t, healthy, "127.0.0.1", envConfig),
+		piholetest.NewClient(t, broken, "localhost", envConfig),
+	}
+	s := NewServer(envConfig, clients)
+	require.NoError(t, clients[0].CollectMetrics(t.Context()))
+	require.Error(t, clients[1].CollectMetrics(t.Context()))
+
+	recorder := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/targets", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var response TargetsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+
+	assert.Equal(t, pihole.SnapshotSchemaVersion, response.SchemaVersion)
+	require.Len(t, response.Targets, 2)
+	assert.Equal(t, "127.0.0.1", response.Targets[0].Name)
+	assert.Equal(t, "success", response.Targets[0].Status)
+	assert.NotNil(t, response.Targets[0].SnapshotCollection)
+	assert.Equal(t, "/api/v1/targets/127.0.0.1/snapshot", response.Targets[0].SnapshotPath)
+	assert.Equal(t, "localhost", response.Targets[1].Name)
+	assert.Equal(t, "error", response.Targets[1].Status)
+	assert.Contains(t, response.Targets[1].LastError, "404")
+	assert.Nil(t, response.Targets[1].SnapshotCollection)
+}
+
+// TestSnapshot tests that the snapshot of a collected target is normalized
+func TestSnapshot(t *testing.T) {
+	envConfig := testEnvConfig()
+	responses := healthyResponses()
+	responses["/api/stats/summary"] = map[string]any{
+		"queries": map[string]any{"total": 100, "blocked": 25, "percent_blocked": 25.0, "replies": map[string]any{"NXDOMAIN": 3}},
+		"clients": map[string]any{"active": 4, "total": 5},
+	}
+	responses["/api/stats/upstreams"] = map[string]any{"upstreams": []map[string]any{
+		{"ip": "1.1.1.1", "name": "one.one.one.one", "port": 53, "count": 10, "statistics": map[string]any{"response": 0.02}},
+		{"ip": "9.9.9.9", "name": "dns.quad9.net", "port": 53, "count": 40},
+	}}
+	responses["/api/info/version"] = map[string]any{"version": map[string]any{"core": map[string]any{"local": map[string]any{"version": "v6.1"}}}}
+	stub := piholetest.NewServer(t, responses)
+	client := piholetest.NewClient(t, stub, "127.0.0.1", envConfig)
+	s := NewServer(envConfig, []*pihole.Client{client})
+	require.NoError(t, client.CollectMetrics(context.Background()))
+
+	recorder := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/targets/127.0.0.1/snapshot", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var snapshot pihole.Snapshot
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot))
+
+	assert.Equal(t, pihole.SnapshotSchemaVersion, snapshot.SchemaVersion)
+	assert.Equal(t, "127.0.0.1", snapshot.Target)
+	assert.Equal(t, 100, snapshot.Summary.QueriesTotal)
+	assert.Equal(t, 25, snapshot.Summary.QueriesBlocked)
+	assert.Equal(t, 4, snapshot.Summary.ClientsActive)
+	assert.Equal(t, 3, snapshot.Summary.Replies["nx_domain"])
+	assert.Equal(t, "enabled", snapshot.Blocking.State)
+	assert.Nil(t, snapshot.Blocking.TimerSeconds)
+	require.Len(t, snapshot.Upstreams, 2)
+	assert.Equal(t, "9.9.9.9", snapshot.Upstreams[0].IP, "the most used upstream must come first")
+	assert.Equal(t, 0.02, snapshot.Upstreams[1].ResponseTimeSeconds)
+	assert.NotNil(t, snapshot.TopLists.Queries)
+	require.NotNil(t, snapshot.Versions)
+	assert.Equal(t, "v6.1", snapshot.Versions.Core)
+}
+
+// TestSnapshot_Errors tests the unknown targets and the ones not collected yet
+func TestSnapshot_Errors(t *testing.T) {
+	envConfig := testEnvConfig()
+	var requests atomic.Int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	t.Cleanup(stub.Close)
+	s := NewServer(envConfig, []*pihole.Client{piholetest.NewClient(t, stub, "127.0.0.1", envConfig)})
+
+	for path, status := range map[string]int{
+		"/api/v1/targets/unknown/snapshot":   http.StatusNotFound,
+		"/api/v1/targets/127.0.0.1/snapshot": http.StatusServiceUnavailable,
+	} {
+		recorder := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, status, recorder.Code, path)
+		var response map[string]string
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.NotEmpty(t, response["error"], path)
+	}
+	assert.Zero(t, requests.Load(), "the snapshot must not collect the target")
+}
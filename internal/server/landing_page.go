@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/version"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+var landingPageTemplate = template.Must(template.New("landing").Funcs(template.FuncMap{
+	"formatTime": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Pi-hole Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.success { color: #2e7d32; }
+.failure { color: #c62828; }
+</style>
+</head>
+<body>
+<h1>Pi-hole Exporter</h1>
+<p>Build {{ .Version }}</p>
+<ul>
+<li><a href="metrics">Metrics</a></li>
+<li><a href="api/v1/targets">Targets API</a></li>
+{{- if .InternalMetricsPath }}
+<li><a href="{{ .InternalMetricsPath }}">Exporter metrics</a></li>
+{{- end }}
+{{- if .Lifecycle }}
+<li><form method="post" action="-/reload"><button type="submit">Reload configuration</button></form></li>
+{{- end }}
+</ul>
+<h2>Targets</h2>
+<table>
+<tr>
+<th>Hostname</th><th>URL</th><th>Version</th><th>Last scrape</th><th>Result</th><th>Duration</th><th>Last error</th><th>Session valid until</th>
+</tr>
+{{- range .Targets }}
+<tr>
+<td>{{ .Hostname }}</td>
+<td>{{ .URL }}</td>
+<td>{{ if .State.Version }}{{ .State.Version }}{{ else }}unknown{{ end }}</td>
+<td>{{ formatTime .State.Time }}</td>
+{{- if .State.Status }}
+<td class="{{ if .State.Status.Err }}failure{{ else }}success{{ end }}">{{ .State.Status.Status }}</td>
+<td>{{ .State.Duration }}</td>
+{{- else }}
+<td>-</td>
+<td>-</td>
+{{- end }}
+<td>{{ if .State.LastError }}{{ formatTime .State.LastErrorTime }}: {{ .State.LastError }}{{ else }}-{{ end }}</td>
+<td>{{ formatTime .State.SessionValidity }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+type landingPageTarget struct {
+	Hostname string
+	URL      string
+	State    pihole.ScrapeState
+}
+
+// landingPageHandler serves an HTML page linking to the metrics and listing
+// each Pi-hole target with the state of its last collection.
+func (s *Server) landingPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+
+		data := struct {
+			Version             string
+			Lifecycle           bool
+			InternalMetricsPath string
+			Targets             []landingPageTarget
+		}{Version: version.Info(), Lifecycle: s.lifecycle, InternalMetricsPath: strings.TrimPrefix(s.internalMetricsPath, "/")}
+		for _, client := range s.Clients() {
+			data.Targets = append(data.Targets, landingPageTarget{
+				Hostname: client.GetHostname(),
+				URL:      client.GetBaseURL(),
+				State:    client.LastScrape(),
+			})
+		}
+
+		var body bytes.Buffer
+		if err := landingPageTemplate.Execute(&body, data); err != nil {
+			log.Errorf("Failed to render landing page: %v", err)
+			http.Error(w, "failed to render landing page", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(body.Bytes())
+	}
+}
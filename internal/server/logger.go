@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// logrusHandler is a slog.Handler forwarding records to the logrus standard
+// logger, for libraries such as the exporter toolkit that log through slog.
+type logrusHandler struct {
+	fields log.Fields
+	group  string
+}
+
+// newSlogLogger returns a slog.Logger writing to the logrus standard logger.
+func newSlogLogger() *slog.Logger {
+	return slog.New(&logrusHandler{fields: log.Fields{}})
+}
+
+func (h *logrusHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return log.IsLevelEnabled(logrusLevel(level))
+}
+
+func (h *logrusHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make(log.Fields, len(h.fields)+record.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		fields[h.key(attr.Key)] = attr.Value.Any()
+		return true
+	})
+	log.WithFields(fields).Log(logrusLevel(record.Level), record.Message)
+	return nil
+}
+
+func (h *logrusHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(log.Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	for _, attr := range attrs {
+		fields[h.key(attr.Key)] = attr.Value.Any()
+	}
+	return &logrusHandler{fields: fields, group: h.group}
+}
+
+func (h *logrusHandler) WithGroup(name string) slog.Handler {
+	return &logrusHandler{fields: h.fields, group: h.key(name)}
+}
+
+func (h *logrusHandler) key(name string) string {
+	if h.group == "" {
+		return name
+	}
+	return h.group + "." + name
+}
+
+func logrusLevel(level slog.Level) log.Level {
+	switch {
+	case level >= slog.LevelError:
+		return log.ErrorLevel
+	case level >= slog.LevelWarn:
+		return log.WarnLevel
+	case level >= slog.LevelInfo:
+		return log.InfoLevel
+	default:
+		return log.DebugLevel
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+)
+
+// newPromHandler serves the metrics of gatherer, the requests being counted in
+// the exporter metrics. Scrapers accepting OpenMetrics get the units of
+// metrics.Units in # UNIT lines, the _created samples of the counters,
+// histograms and summaries, and the exemplars. promhttp cannot write the units,
+// so it only serves the other formats, the protobuf one carrying the units in
+// the family metadata.
+func newPromHandler(gatherer prometheus.Gatherer) http.Handler {
+	gatherer = unitGatherer{gatherer}
+	fallback := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+
+	return promhttp.InstrumentMetricHandler(metrics.Registry, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		if format.FormatType() != expfmt.TypeOpenMetrics {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		families, err := gatherer.Gather()
+		if err != nil {
+			log.Errorf("Failed to gather metrics: %v", err)
+			http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", string(format))
+		w.Header().Add("Vary", "Accept-Encoding")
+		var out io.Writer = w
+		if acceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+
+		encoder := expfmt.NewEncoder(out, format, expfmt.WithUnit(), expfmt.WithCreatedLines())
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				log.Errorf("Failed to encode metric family %s: %v", family.GetName(), err)
+				return
+			}
+		}
+		if closer, ok := encoder.(expfmt.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Errorf("Failed to encode metrics: %v", err)
+			}
+		}
+	}))
+}
+
+// unitGatherer sets the units of metrics.Units on the gathered families.
+type unitGatherer struct {
+	prometheus.Gatherer
+}
+
+// Gather implements prometheus.Gatherer.
+func (g unitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	for _, family := range families {
+		if unit, found := metrics.Units[family.GetName()]; found {
+			family.Unit = &unit
+		}
+	}
+	return families, err
+}
+
+// acceptsGzip tells whether the client accepts a gzip-compressed response.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if name == "gzip" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+)
+
+const openMetricsAccept = "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5"
+
+func newTestRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	responseTime := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_forward_destinations_responsetime"}, []string{"hostname"})
+	responseTime.WithLabelValues("127.0.0.1").Set(0.02)
+	responseTimeSeconds := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_forward_destinations_responsetime_seconds"}, []string{"hostname"})
+	responseTimeSeconds.WithLabelValues("127.0.0.1").Set(0.02)
+	requests := prometheus.NewCounter(prometheus.CounterOpts{Name: "pihole_exporter_ftl_requests_total"})
+	requests.Inc()
+	registry.MustRegister(responseTime, responseTimeSeconds, requests)
+	return registry
+}
+
+// TestPromHandler_OpenMetrics tests that OpenMetrics scrapes get the units and _created samples and keep the metric names
+func TestPromHandler_OpenMetrics(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Accept", openMetricsAccept)
+	recorder := httptest.NewRecorder()
+	newPromHandler(newTestRegistry()).ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "application/openmetrics-text")
+	body := recorder.Body.String()
+	assert.Contains(t, body, `pihole_forward_destinations_responsetime{hostname="127.0.0.1"} 0.02`)
+	assert.Contains(t, body, "# UNIT pihole_forward_destinations_responsetime_seconds seconds\n")
+	assert.Contains(t, body, `pihole_forward_destinations_responsetime_seconds{hostname="127.0.0.1"} 0.02`)
+	assert.NotContains(t, body, "# UNIT pihole_forward_destinations_responsetime ")
+	assert.Contains(t, body, "pihole_exporter_ftl_requests_total 1.0\n")
+	assert.Contains(t, body, "pihole_exporter_ftl_requests_created ")
+	assert.Contains(t, body, "# EOF\n")
+}
+
+// TestPromHandler_Text tests that the other scrapes keep the Prometheus text format and metric names
+func TestPromHandler_Text(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newPromHandler(newTestRegistry()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+	body := recorder.Body.String()
+	assert.Contains(t, body, `pihole_forward_destinations_responsetime{hostname="127.0.0.1"} 0.02`)
+	assert.NotContains(t, body, "# UNIT")
+	assert.NotContains(t, body, "_created")
+}
+
+// TestPromHandler_Gzip tests that OpenMetrics scrapes are compressed when accepted
+func TestPromHandler_Gzip(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Accept", openMetricsAccept)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	newPromHandler(newTestRegistry()).ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(recorder.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "# EOF\n")
+}
+
+// TestPromHandler_Units tests that the units are sent in the OpenMetrics and protobuf formats, only for the metrics which have one
+func TestPromHandler_Units(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.BlockingTimer, metrics.Status)
+	metrics.BlockingTimer.WithLabelValues("127.0.0.1").Set(30)
+	metrics.Status.WithLabelValues("127.0.0.1").Set(1)
+	t.Cleanup(func() {
+		metrics.BlockingTimer.Reset()
+		metrics.Status.Reset()
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Accept", openMetricsAccept)
+	recorder := httptest.NewRecorder()
+	newPromHandler(registry).ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, "# UNIT pihole_blocking_timer_seconds seconds\n")
+	assert.Contains(t, body, `pihole_blocking_timer_seconds{hostname="127.0.0.1"} 30.0`)
+	assert.NotContains(t, body, "# UNIT pihole_status")
+
+	request = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeProtoDelim)))
+	recorder = httptest.NewRecorder()
+	newPromHandler(registry).ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	units := map[string]string{}
+	decoder := expfmt.NewDecoder(recorder.Body, expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for {
+		var family dto.MetricFamily
+		if err := decoder.Decode(&family); errors.Is(err, io.EOF) {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+		units[family.GetName()] = family.GetUnit()
+	}
+	assert.Equal(t, map[string]string{"pihole_blocking_timer_seconds": "seconds", "pihole_status": ""}, units)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+// TargetReadiness is the readiness detail of a Pi-hole target.
+type TargetReadiness struct {
+	Hostname        string     `json:"hostname"`
+	Ready           bool       `json:"ready"`
+	LastScrape      *time.Time `json:"last_scrape,omitempty"`
+	LastStatus      string     `json:"last_status,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	SessionValidity *time.Time `json:"session_valid_until,omitempty"`
+}
+
+// ReadinessResponse is the body returned by the readiness endpoint.
+type ReadinessResponse struct {
+	Ready   bool              `json:"ready"`
+	Mode    string            `json:"mode"`
+	Targets []TargetReadiness `json:"targets"`
+}
+
+// readinessChecker tells whether the exporter is ready according to the
+// number of Pi-hole targets scraped successfully within maxAge.
+type readinessChecker struct {
+	mode   string
+	maxAge time.Duration
+}
+
+func newReadinessChecker(envConfig *config.EnvConfig) *readinessChecker {
+	return &readinessChecker{
+		mode:   envConfig.ReadinessMode,
+		maxAge: envConfig.ReadinessMaxAge,
+	}
+}
+
+// check evaluates the readiness of the given clients from their last
+// collection, the check itself collecting nothing.
+func (r *readinessChecker) check(clients []*pihole.Client) ReadinessResponse {
+	response := ReadinessResponse{Mode: r.mode, Targets: make([]TargetReadiness, 0, len(clients))}
+	if r.mode == config.ReadinessModeNone || r.mode == "" {
+		response.Mode = config.ReadinessModeNone
+		response.Ready = true
+	}
+
+	readyTargets := 0
+	for _, client := range clients {
+		target := r.targetReadiness(client)
+		if target.Ready {
+			readyTargets++
+		}
+		response.Targets = append(response.Targets, target)
+	}
+
+	switch r.mode {
+	case config.ReadinessModeAny:
+		response.Ready = readyTargets > 0
+	case config.ReadinessModeQuorum:
+		response.Ready = readyTargets > len(clients)/2
+	case config.ReadinessModeAll:
+		response.Ready = len(clients) > 0 && readyTargets == len(clients)
+	}
+	return response
+}
+
+func (r *readinessChecker) isFresh(state pihole.ScrapeState) bool {
+	return state.Status != nil && state.Status.Status == pihole.MetricsCollectionSuccess && time.Since(state.Time) <= r.maxAge
+}
+
+func (r *readinessChecker) targetReadiness(client *pihole.Client) TargetReadiness {
+	state := client.LastScrape()
+	target := TargetReadiness{
+		Hostname: client.GetHostname(),
+		Ready:    r.isFresh(state),
+	}
+	if state.Status != nil {
+		target.LastScrape = &state.Time
+		target.LastStatus = state.Status.Status.String()
+		if state.Status.Err != nil {
+			target.Error = state.Status.Err.Error()
+		}
+	}
+	if !state.SessionValidity.IsZero() {
+		target.SessionValidity = &state.SessionValidity
+	}
+	return target
+}
+
+func (s *Server) readinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		response := s.readiness.check(s.Clients())
+
+		status := http.StatusServiceUnavailable
+		if response.Ready {
+			status = http.StatusOK
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Warnf("Failed to write readiness: %v", err)
+		}
+	}
+}
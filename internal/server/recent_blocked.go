@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eko/pihole-exporter/internal/pihole"
+)
+
+// BlockedDomain is a domain recently blocked by one or several Pi-hole instances.
+type BlockedDomain struct {
+	Domain    string   `json:"domain"`
+	Hostnames []string `json:"hostnames"`
+}
+
+// RecentBlockedResponse is the body returned by the recently blocked domains endpoint.
+type RecentBlockedResponse struct {
+	Domains []BlockedDomain   `json:"domains"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+type recentBlockedResult struct {
+	index    int
+	hostname string
+	domains  []string
+	err      error
+}
+
+// recentBlockedHandler fans in the recently blocked domains of every Pi-hole
+// instance and returns them deduplicated as JSON.
+func (s *Server) recentBlockedHandler(count uint, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		clients := s.Clients()
+
+		results := make(chan recentBlockedResult, len(clients))
+		var wg sync.WaitGroup
+		for i, client := range clients {
+			wg.Add(1)
+			go func(i int, c *pihole.Client) {
+				defer wg.Done()
+				domains, err := c.GetRecentBlocked(ctx, count)
+				results <- recentBlockedResult{index: i, hostname: c.GetHostname(), domains: domains, err: err}
+			}(i, client)
+		}
+
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		// Keep the configuration order of the clients so that the output is stable.
+		byIndex := make(map[int]recentBlockedResult, len(clients))
+		response := RecentBlockedResponse{}
+	collect:
+		for range clients {
+			select {
+			case result := <-results:
+				byIndex[result.index] = result
+			case <-ctx.Done():
+				break collect
+			}
+		}
+
+		ordered := make([]recentBlockedResult, 0, len(clients))
+		for i, client := range clients {
+			result, found := byIndex[i]
+			if !found {
+				result = recentBlockedResult{hostname: client.GetHostname(), err: ctx.Err()}
+			}
+			if result.err != nil {
+				if response.Errors == nil {
+					response.Errors = make(map[string]string)
+				}
+				response.Errors[result.hostname] = result.err.Error()
+				log.WithField("hostname", result.hostname).Warnf("An error occurred while fetching recently blocked domains: %v", result.err)
+				continue
+			}
+			ordered = append(ordered, result)
+		}
+		response.Domains = mergeRecentBlocked(ordered)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Warnf("Failed to write recently blocked domains: %v", err)
+		}
+	}
+}
+
+// mergeRecentBlocked interleaves the per-instance lists, most recent first, and
+// folds a domain blocked by several instances into a single entry.
+func mergeRecentBlocked(results []recentBlockedResult) []BlockedDomain {
+	domains := make([]BlockedDomain, 0)
+	index := make(map[string]int)
+
+	for position := 0; ; position++ {
+		remaining := false
+		for _, result := range results {
+			if position >= len(result.domains) {
+				continue
+			}
+			remaining = true
+
+			domain := result.domains[position]
+			i, found := index[domain]
+			if !found {
+				index[domain] = len(domains)
+				domains = append(domains, BlockedDomain{Domain: domain, Hostnames: []string{result.hostname}})
+				continue
+			}
+			if !slices.Contains(domains[i].Hostnames, result.hostname) {
+				domains[i].Hostnames = append(domains[i].Hostnames, result.hostname)
+			}
+		}
+		if !remaining {
+			return domains
+		}
+	}
+}
@@ -1,153 +1,290 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"strings"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/metrics"
 	"github.com/eko/pihole-exporter/internal/pihole"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/eko/pihole-exporter/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/exporter-toolkit/web"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/net/context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.yaml.in/yaml/v2"
 )
 
 // Server is the struct for the HTTP server.
 type Server struct {
-	httpServer *http.Server
+	httpServer    *http.Server
+	webConfigFile string
+	lifecycle     bool
+	readiness     *readinessChecker
+	// internalMetricsPath serves the metrics of the exporter itself apart,
+	// when set.
+	internalMetricsPath string
+
+	mu      sync.RWMutex
+	clients []*pihole.Client
+	reload  func() error
 }
 
 // NewServer method initializes a new HTTP server instance and associates
 // the different routes that will be used by Prometheus (metrics) or for monitoring (readiness, liveness).
-func NewServer(addr string, port uint16, clients []*pihole.Client) *Server {
+func NewServer(envConfig *config.EnvConfig, clients []*pihole.Client) *Server {
 	mux := http.NewServeMux()
 	httpServer := &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", addr, port),
+		Addr:    fmt.Sprintf("%s:%d", envConfig.BindAddr, envConfig.Port),
 		Handler: mux,
 	}
 
 	s := &Server{
-		httpServer: httpServer,
-	}
+		httpServer:    httpServer,
+		clients:       clients,
+		webConfigFile: envConfig.WebConfigFile,
+		lifecycle:     envConfig.WebEnableLifecycle,
+		readiness:     newReadinessChecker(envConfig),
 
-	mux.HandleFunc("/metrics", func(writer http.ResponseWriter, request *http.Request) {
-		log.Debugf("request.Header: %+v\n", request.Header)
+		internalMetricsPath: envConfig.InternalMetricsPath,
+	}
 
-		// Use a WaitGroup to track goroutines
-		var wg sync.WaitGroup
-		// Create a context with timeout for metrics collection
-		ctx, cancel := context.WithTimeout(request.Context(), 10*time.Second)
-		defer cancel()
+	var piholeMetrics prometheus.Gatherer = prometheus.Gatherers{prometheus.DefaultGatherer, metrics.Registry}
+	if envConfig.InternalMetricsPath != "" {
+		piholeMetrics = prometheus.DefaultGatherer
+		mux.Handle(envConfig.InternalMetricsPath, newPromHandler(metrics.Registry))
+	}
+	mux.Handle("/metrics", s.metricsHandler(envConfig.ScrapeTimeout, envConfig.ScrapeTimeoutOffset, newPromHandler(piholeMetrics)))
 
-		// Channel to collect results from goroutines
-		resultChan := make(chan *pihole.ClientChannel, len(clients))
-
-		for _, client := range clients {
-			wg.Add(1)
-			go func(c *pihole.Client) {
-				defer wg.Done()
-
-				// Create a channel for this goroutine
-				doneChan := make(chan struct{})
-
-				go func() {
-					c.CollectMetricsAsync(writer, request)
-					close(doneChan)
-				}()
-
-				// Wait for either completion or timeout
-				select {
-				case <-doneChan:
-					// Normal completion, status will be read below
-				case <-ctx.Done():
-					// Timeout occurred
-					resultChan <- &pihole.ClientChannel{
-						Status: pihole.MetricsCollectionTimeout,
-						Err:    fmt.Errorf("metrics collection from %s timed out", c.GetHostname()),
-					}
-					// We need to read from the Status channel to prevent blocking
-					go func() {
-						<-c.Status // Discard the result when it eventually comes
-					}()
-				}
-			}(client)
-		}
+	mux.Handle("GET /api/v1/targets", s.targetsHandler())
+	mux.Handle("GET /api/v1/targets/{name}/snapshot", s.snapshotHandler())
 
-		// Start a goroutine to close resultChan when all goroutines are done
-		go func() {
-			wg.Wait()
-			close(resultChan)
-		}()
-
-		// Read all results
-		for _, client := range clients {
-			status := <-client.Status
-			if status.Status != pihole.MetricsCollectionSuccess {
-				log.Warnf("An error occurred while contacting %s: %+v\n", client.GetHostname(), status.Err)
-			}
-		}
+	if envConfig.RecentBlockedCount > 0 {
+		mux.Handle("/recent_blocked", s.recentBlockedHandler(envConfig.RecentBlockedCount, envConfig.Timeout))
+	}
 
-		promhttp.Handler().ServeHTTP(writer, request)
-	})
+	if envConfig.WebEnableLifecycle {
+		mux.Handle("/-/reload", s.reloadHandler())
+	}
 
+	mux.Handle("/", s.landingPageHandler())
 	mux.Handle("/readiness", s.readinessHandler())
 	mux.Handle("/liveness", s.livenessHandler())
 
 	return s
 }
 
-// ListenAndServe method serves HTTP requests.
+// ValidateLifecycle checks that the lifecycle endpoints, when enabled, are
+// protected by the basic_auth_users of the web configuration file, as anyone
+// reaching them could reload the configuration otherwise.
+func ValidateLifecycle(envConfig *config.EnvConfig) error {
+	if !envConfig.WebEnableLifecycle {
+		return nil
+	}
+	if envConfig.WebConfigFile == "" {
+		return errors.New("the lifecycle endpoints require basic_auth_users in a web configuration file")
+	}
+
+	content, err := os.ReadFile(envConfig.WebConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read web configuration file: %w", err)
+	}
+	var webConfig struct {
+		Users map[string]string `yaml:"basic_auth_users"`
+	}
+	if err := yaml.Unmarshal(content, &webConfig); err != nil {
+		return fmt.Errorf("failed to parse web configuration file: %w", err)
+	}
+	if len(webConfig.Users) == 0 {
+		return fmt.Errorf("the lifecycle endpoints require basic_auth_users in %s", envConfig.WebConfigFile)
+	}
+	return nil
+}
+
+// Clients returns the Pi-hole clients the server collects metrics from.
+func (s *Server) Clients() []*pihole.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clients
+}
+
+// SetClients replaces the Pi-hole clients the server collects metrics from
+// and returns the previous ones, which are left to the caller to close.
+func (s *Server) SetClients(clients []*pihole.Client) []*pihole.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.clients
+	s.clients = clients
+	return previous
+}
+
+// OnReload sets the function called when a reload is requested on /-/reload.
+func (s *Server) OnReload(reload func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload = reload
+}
+
+// ListenAndServe method serves HTTP requests. TLS and basic authentication are
+// enabled according to the exporter toolkit web configuration file, if any.
 func (s *Server) ListenAndServe() error {
-	return s.httpServer.ListenAndServe()
+	return web.ListenAndServe(s.httpServer, s.webFlags(), newSlogLogger())
 }
 
-// Stop method stops the HTTP server (so the exporter become unavailable).
-func (s *Server) Stop() {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+// Serve method serves HTTP requests on the given listener, see ListenAndServe.
+func (s *Server) Serve(listener net.Listener) error {
+	return web.Serve(listener, s.httpServer, s.webFlags(), newSlogLogger())
+}
+
+func (s *Server) webFlags() *web.FlagConfig {
+	return &web.FlagConfig{
+		WebListenAddresses: &[]string{s.httpServer.Addr},
+		WebConfigFile:      &s.webConfigFile,
+	}
+}
 
-	s.httpServer.Shutdown(ctx)
+// Shutdown method stops accepting requests and waits for the requests in
+// flight to end, until ctx is done. The collections still running are left to
+// be cancelled by closing the Pi-hole clients.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
 
-// handleMetrics, helper function is unused
-func (s *Server) handleMetrics(clients []*pihole.Client) http.HandlerFunc {
+// scrapeTimeoutHeader is the header in which Prometheus sends the scrape timeout.
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// metricsHandler collects the metrics of every Pi-hole instance before serving
+// them. The collections are given the scrape timeout of Prometheus minus
+// offset, or defaultTimeout without it. A target whose collection did not end
+// in time is reported as timed out and keeps its previous metrics, so that the
+// scrape does not fail as a whole.
+func (s *Server) metricsHandler(defaultTimeout, offset time.Duration, promHandler http.Handler) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
-		errors := make([]string, 0)
+		log.WithField("headers", redactHeaders(request.Header)).Debug("Scrape requested")
 
-		for _, client := range clients {
-			if err := client.CollectMetrics(writer, request); err != nil {
-				errors = append(errors, err.Error())
-				log.Warnf("error collecting metrics from %s: %+v\n", client.GetHostname(), err)
-			}
-		}
+		// The scrape joins the trace of the caller, if any.
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, request.Method+" "+request.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(request.Method),
+				semconv.URLPath(request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		ctx, cancel := context.WithTimeout(ctx, scrapeTimeout(request, defaultTimeout, offset))
+		defer cancel()
+		s.Collect(ctx)
+
+		promHandler.ServeHTTP(writer, request)
+	}
+}
 
-		if len(errors) == len(clients) {
-			writer.WriteHeader(http.StatusBadRequest)
-			body := strings.Join(errors, "\n")
-			_, _ = writer.Write([]byte(body))
+// Collect collects the metrics of every Pi-hole instance in parallel, until ctx
+// is done. A target whose collection did not end in time is reported as timed
+// out and keeps its previous metrics.
+func (s *Server) Collect(ctx context.Context) {
+	clients := s.Clients()
+
+	// Concurrent scrapes of a target share its collection in flight.
+	results := make([]*pihole.CollectionResult, len(clients))
+	durations := make([]time.Duration, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, c *pihole.Client) {
+			defer wg.Done()
+			start := time.Now()
+			results[i] = c.Collect(ctx)
+			durations[i] = time.Since(start)
+		}(i, client)
+	}
+	wg.Wait()
+
+	for i, client := range clients {
+		hostname := client.GetHostname()
+		timedOut := results[i].Status == pihole.MetricsCollectionTimeout
+		metrics.ScrapeSuccess.WithLabelValues(hostname).Set(metrics.BoolToFloat(results[i].Status == pihole.MetricsCollectionSuccess))
+		metrics.ScrapeTimeout.WithLabelValues(hostname).Set(metrics.BoolToFloat(timedOut))
+		if results[i].Status != pihole.MetricsCollectionSuccess {
+			log.WithFields(log.Fields{"hostname": hostname, "duration": durations[i].String()}).Warnf("An error occurred while collecting metrics: %v", results[i].Err)
 		}
+	}
+}
+
+// scrapeTimeout returns the time given to the collections of a scrape.
+func scrapeTimeout(request *http.Request, defaultTimeout, offset time.Duration) time.Duration {
+	header := request.Header.Get(scrapeTimeoutHeader)
+	if header == "" {
+		return defaultTimeout
+	}
 
-		promhttp.Handler().ServeHTTP(writer, request)
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		log.Warnf("Invalid %s header %q, using the default scrape timeout %s", scrapeTimeoutHeader, header, defaultTimeout)
+		return defaultTimeout
 	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	// Keep the whole scrape timeout when it is shorter than the offset.
+	if timeout > offset {
+		timeout -= offset
+	}
+	return timeout
 }
 
-func (s *Server) readinessHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, req *http.Request) {
-		status := http.StatusNotFound
-		if s.isReady() {
-			status = http.StatusOK
+// sensitiveHeaders are the request headers which values are not logged.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Ftl-Sid"}
+
+// redactHeaders returns a copy of headers without the values of the sensitive ones.
+func redactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for _, name := range sensitiveHeaders {
+		if _, found := redacted[name]; found {
+			redacted[name] = []string{"<redacted>"}
 		}
-		w.WriteHeader(status)
 	}
+	return redacted
 }
 
-func (s *Server) livenessHandler() http.HandlerFunc {
+func (s *Server) reloadHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.RLock()
+		reload := s.reload
+		s.mu.RUnlock()
+		if reload == nil {
+			http.Error(w, "Reload is not supported", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := reload(); err != nil {
+			log.Errorf("Failed to reload configuration: %v", err)
+			http.Error(w, fmt.Sprintf("failed to reload configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func (s *Server) isReady() bool {
-	return s.httpServer != nil
+func (s *Server) livenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
 }
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+// TestShutdown tests that a shutdown cancels the scrapes still in flight after
+// the grace period, logs the sessions out and leaves no goroutine behind
+func TestShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var mu sync.Mutex
+	var logouts []string
+	scraping := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			mu.Lock()
+			logouts = append(logouts, r.Header.Get("X-FTL-SID"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write([]byte(`{"session":{"valid":true,"sid":"sid","validity":300}}`))
+	})
+	// The summary never comes, until the exporter gives up.
+	mux.HandleFunc("/api/stats/summary", func(w http.ResponseWriter, r *http.Request) {
+		close(scraping)
+		<-r.Context().Done()
+	})
+	stub := httptest.NewServer(mux)
+	defer stub.Close()
+
+	envConfig := testEnvConfig()
+	envConfig.Timeout = time.Minute
+	client := piholetest.NewClient(t, stub, "127.0.0.1", envConfig)
+	s := NewServer(envConfig, []*pihole.Client{client})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listener) }()
+
+	httpClient := &http.Client{Transport: &http.Transport{}}
+	defer httpClient.CloseIdleConnections()
+	scraped := make(chan error, 1)
+	go func() {
+		resp, err := httpClient.Get("http://" + listener.Addr().String() + "/metrics")
+		if err == nil {
+			err = resp.Body.Close()
+		}
+		scraped <- err
+	}()
+	<-scraping
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.True(t, errors.Is(<-served, http.ErrServerClosed))
+
+	// The scrape is still in flight, closing the client cancels it.
+	select {
+	case err := <-scraped:
+		t.Fatalf("scrape ended before the client was closed: %v", err)
+	default:
+	}
+	client.Close()
+	assert.NoError(t, <-scraped)
+
+	mu.Lock()
+	assert.Equal(t, []string{"sid"}, logouts)
+	mu.Unlock()
+
+	state := client.LastScrape()
+	require.NotNil(t, state.Status)
+	assert.Equal(t, pihole.MetricsCollectionError, state.Status.Status)
+
+	_, err = client.GetRecentBlocked(context.Background(), 1)
+	assert.ErrorIs(t, err, pihole.ErrClientClosed)
+}
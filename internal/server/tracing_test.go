@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/pihole/piholetest"
+)
+
+// TestMetrics_Tracing tests that a scrape is traced down to the requests made to Pi-hole
+func TestMetrics_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	envConfig := testEnvConfig()
+	client := piholetest.NewClient(t, piholetest.NewServer(t, healthyResponses()), "127.0.0.1", envConfig)
+	s := NewServer(envConfig, []*pihole.Client{client})
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	require.Contains(t, spans, "GET /metrics")
+	require.Contains(t, spans, "collect")
+	require.Contains(t, spans, "POST /api/auth")
+	require.Contains(t, spans, "GET /api/stats/summary")
+
+	scrape := spans["GET /metrics"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", scrape.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", scrape.Parent.SpanID().String())
+	assert.Equal(t, trace.SpanKindServer, scrape.SpanKind)
+
+	collect := spans["collect"]
+	assert.Equal(t, scrape.SpanContext.SpanID(), collect.Parent.SpanID())
+	assert.Contains(t, collect.Attributes, attribute.String("server.address", "127.0.0.1"))
+
+	for _, name := range []string{"POST /api/auth", "GET /api/stats/summary"} {
+		request := spans[name]
+		_, endpoint, _ := strings.Cut(name, " ")
+		assert.Equal(t, collect.SpanContext.SpanID(), request.Parent.SpanID(), name)
+		assert.Equal(t, trace.SpanKindClient, request.SpanKind, name)
+		assert.Contains(t, request.Attributes, attribute.Int("http.response.status_code", http.StatusOK), name)
+		assert.Contains(t, request.Attributes, attribute.String("url.full", client.GetBaseURL()+endpoint), name)
+		assertHasAttribute(t, request.Attributes, "http.response.body.size")
+	}
+}
+
+// TestMetrics_Exemplars tests that the durations of the requests made to Pi-hole are linked to their trace
+func TestMetrics_Exemplars(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	previousProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previousProvider) })
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.FTLRequestDuration)
+	t.Cleanup(metrics.FTLRequestDuration.Reset)
+
+	envConfig := testEnvConfig()
+	client := piholetest.NewClient(t, piholetest.NewServer(t, healthyResponses()), "127.0.0.1", envConfig)
+	ctx, span := provider.Tracer("test").Start(t.Context(), "test")
+	require.NoError(t, client.CollectMetrics(ctx))
+	span.End()
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Accept", openMetricsAccept)
+	recorder := httptest.NewRecorder()
+	newPromHandler(registry).ServeHTTP(recorder, request)
+
+	assert.Contains(t, recorder.Body.String(), `trace_id="`+span.SpanContext().TraceID().String()+`"`)
+}
+
+func assertHasAttribute(t *testing.T, attributes []attribute.KeyValue, key attribute.Key) {
+	t.Helper()
+	for _, attr := range attributes {
+		if attr.Key == key {
+			return
+		}
+	}
+	t.Errorf("missing attribute %s in %v", key, attributes)
+}
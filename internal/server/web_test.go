@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// certificate is a generated key pair and the files it was written to.
+type certificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newCertificate generates a certificate for name, signed by parent or a
+// self-signed CA when parent is nil, and writes it as PEM into dir.
+func newCertificate(t *testing.T, dir, name string, parent *certificate, usage ...x509.ExtKeyUsage) *certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  usage,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	c := &certificate{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return c
+}
+
+func (c *certificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// TestListenerWebConfig tests TLS, client certificates, basic authentication
+// and response headers configured through the web configuration file
+func TestListenerWebConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCertificate(t, dir, "ca", nil)
+	serverCert := newCertificate(t, dir, "server", ca, x509.ExtKeyUsageServerAuth)
+	clientCert := newCertificate(t, dir, "client", ca, x509.ExtKeyUsageClientAuth)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	webConfigFile := filepath.Join(dir, "web.yml")
+	webConfig := fmt.Sprintf(`tls_server_config:
+  cert_file: %s
+  key_file: %s
+  client_auth_type: RequireAndVerifyClientCert
+  client_ca_file: %s
+basic_auth_users:
+  prometheus: %s
+http_server_config:
+  headers:
+    X-Frame-Options: deny
+`, serverCert.certFile, serverCert.keyFile, ca.certFile, hash)
+	require.NoError(t, os.WriteFile(webConfigFile, []byte(webConfig), 0o600))
+
+	envConfig := testEnvConfig()
+	envConfig.WebConfigFile = webConfigFile
+	s := NewServer(envConfig, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listener) }()
+	t.Cleanup(func() {
+		assert.NoError(t, s.Shutdown(context.Background()))
+		assert.True(t, errors.Is(<-served, http.ErrServerClosed))
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newHTTPClient := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      roots,
+				Certificates: certificates,
+			}},
+		}
+	}
+	url := fmt.Sprintf("https://%s/liveness", listener.Addr())
+
+	t.Run("authenticated", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("prometheus", "s3cret")
+
+		resp, err := newHTTPClient(clientCert.tlsCertificate()).Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "deny", resp.Header.Get("X-Frame-Options"))
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("prometheus", "wrong")
+
+		resp, err := newHTTPClient(clientCert.tlsCertificate()).Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("prometheus", "s3cret")
+
+		resp, err := newHTTPClient().Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		assert.Error(t, err)
+	})
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		resp, err := newHTTPClient().Get(fmt.Sprintf("http://%s/liveness", listener.Addr()))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+// TestValidateLifecycle tests that the lifecycle endpoints require basic authentication
+func TestValidateLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	withUsers := filepath.Join(dir, "users.yml")
+	require.NoError(t, os.WriteFile(withUsers, []byte("basic_auth_users:\n  prometheus: hash\n"), 0o600))
+	withoutUsers := filepath.Join(dir, "headers.yml")
+	require.NoError(t, os.WriteFile(withoutUsers, []byte("http_server_config:\n  headers:\n    X-Frame-Options: deny\n"), 0o600))
+
+	envConfig := testEnvConfig()
+	assert.NoError(t, ValidateLifecycle(envConfig), "disabled lifecycle requires nothing")
+
+	envConfig.WebEnableLifecycle = true
+	assert.Error(t, ValidateLifecycle(envConfig))
+	envConfig.WebConfigFile = withoutUsers
+	assert.Error(t, ValidateLifecycle(envConfig))
+	envConfig.WebConfigFile = filepath.Join(dir, "missing.yml")
+	assert.Error(t, ValidateLifecycle(envConfig))
+	envConfig.WebConfigFile = withUsers
+	assert.NoError(t, ValidateLifecycle(envConfig))
+}
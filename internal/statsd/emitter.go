@@ -0,0 +1,236 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/push"
+)
+
+const (
+	// sinkName identifies the DogStatsD sink in the logs and metrics.
+	sinkName = "statsd"
+	// maxUDPPayload keeps the datagrams below the usual MTU, and
+	// maxUnixPayload is the default buffer of the Datadog agent socket.
+	maxUDPPayload  = 1432
+	maxUnixPayload = 8192
+)
+
+// Options configures an Emitter.
+type Options struct {
+	// Address is the DogStatsD server, such as udp://localhost:8125 or
+	// unix:///var/run/datadog/dsd.socket. A bare host:port is UDP.
+	Address string
+	// Prefix is prepended to the metric names.
+	Prefix string
+	// Tags are added to every metric, as name:value.
+	Tags []string
+	// SampleRates are the rates at which the series of a metric family are
+	// sent, every series being sent for the others.
+	SampleRates map[string]float64
+}
+
+// Emitter sends the metrics as DogStatsD gauges and counts, for the sites
+// monitored by Datadog agents. Gauges are sent as they are, while counters,
+// histograms and summaries counts are sent as counts of their increase since
+// the previous push. The labels become tags.
+type Emitter struct {
+	conn        net.Conn
+	maxPayload  int
+	prefix      string
+	tags        []string
+	sampleRates map[string]float64
+	// sample tells whether a series sent at the given rate is sent this time.
+	sample func(rate float64) bool
+
+	mu sync.Mutex
+	// previous holds the last value of each counter series.
+	previous map[string]float64
+}
+
+// NewEmitter returns an Emitter to the DogStatsD server of opts.
+func NewEmitter(opts Options) (*Emitter, error) {
+	network, address, maxPayload := "udp", opts.Address, maxUDPPayload
+	switch {
+	case strings.HasPrefix(opts.Address, "unix://"):
+		network, address, maxPayload = "unixgram", strings.TrimPrefix(opts.Address, "unix://"), maxUnixPayload
+	case strings.HasPrefix(opts.Address, "udp://"):
+		address = strings.TrimPrefix(opts.Address, "udp://")
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DogStatsD server %s: %w", opts.Address, err)
+	}
+
+	return &Emitter{
+		conn:        conn,
+		maxPayload:  maxPayload,
+		prefix:      opts.Prefix,
+		tags:        opts.Tags,
+		sampleRates: opts.SampleRates,
+		sample:      func(rate float64) bool { return rand.Float64() < rate },
+		previous:    make(map[string]float64),
+	}, nil
+}
+
+// Name implements push.Sink.
+func (e *Emitter) Name() string {
+	return sinkName
+}
+
+// Push implements push.Sink, the timestamp being set by the server.
+func (e *Emitter) Push(_ context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	lines := e.encode(families)
+
+	var errs []error
+	var datagram []byte
+	flush := func() {
+		if len(datagram) == 0 {
+			return
+		}
+		if _, err := e.conn.Write(datagram); err != nil {
+			errs = append(errs, err)
+		}
+		datagram = datagram[:0]
+	}
+	for _, line := range lines {
+		if len(datagram) > 0 && len(datagram)+1+len(line) > e.maxPayload {
+			flush()
+		}
+		if len(datagram) > 0 {
+			datagram = append(datagram, '\n')
+		}
+		datagram = append(datagram, line...)
+	}
+	flush()
+
+	if len(errs) > 0 {
+		metrics.PushBatches.WithLabelValues(sinkName, "dropped").Inc()
+		return fmt.Errorf("failed to send metrics to DogStatsD: %w", errors.Join(errs...))
+	}
+	metrics.PushBatches.WithLabelValues(sinkName, "success").Inc()
+	return nil
+}
+
+// encode returns the DogStatsD lines of the metric families.
+func (e *Emitter) encode(families []*dto.MetricFamily) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The series gone since the previous push are forgotten.
+	current := make(map[string]float64, len(e.previous))
+	defer func() { e.previous = current }()
+
+	var lines []string
+	for _, family := range families {
+		rate, sampled := e.sampleRates[family.GetName()]
+		for _, sample := range push.Flatten([]*dto.MetricFamily{family}) {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+
+			metricType, value := "g", sample.Value
+			if isCount(family, sample) {
+				key := seriesKey(sample)
+				previous, found := e.previous[key]
+				current[key] = sample.Value
+				// The first value only sets the base of the next increase.
+				if !found {
+					continue
+				}
+				metricType, value = "c", sample.Value-previous
+				// A counter going down was reset.
+				if value < 0 {
+					value = sample.Value
+				}
+			}
+
+			// The counters keep their base when not sent, the server scales
+			// the sampled counts.
+			if sampled && !e.sample(rate) {
+				continue
+			}
+			lines = append(lines, e.encodeLine(sample, metricType, value, sampled, rate))
+		}
+	}
+	return lines
+}
+
+// isCount tells whether a sample is cumulative: counters, and the buckets, sum
+// and count of histograms and summaries.
+func isCount(family *dto.MetricFamily, sample push.Sample) bool {
+	switch family.GetType() {
+	case dto.MetricType_COUNTER, dto.MetricType_HISTOGRAM:
+		return true
+	case dto.MetricType_SUMMARY:
+		return sample.Name != family.GetName()
+	default:
+		return false
+	}
+}
+
+func seriesKey(sample push.Sample) string {
+	var b strings.Builder
+	b.WriteString(sample.Name)
+	for _, label := range sample.Labels {
+		b.WriteByte(0)
+		b.WriteString(label.GetName())
+		b.WriteByte(0)
+		b.WriteString(label.GetValue())
+	}
+	return b.String()
+}
+
+func (e *Emitter) encodeLine(sample push.Sample, metricType string, value float64, sampled bool, rate float64) string {
+	var b strings.Builder
+	b.WriteString(e.prefix)
+	b.WriteString(sample.Name)
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(metricType)
+	if sampled {
+		b.WriteString("|@")
+		b.WriteString(strconv.FormatFloat(rate, 'f', -1, 64))
+	}
+
+	first := true
+	writeTag := func(tag string) {
+		if first {
+			b.WriteString("|#")
+			first = false
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tag)
+	}
+	for _, tag := range e.tags {
+		writeTag(tag)
+	}
+	for _, label := range sample.Labels {
+		// Empty labels are absent in Prometheus, so are they in the tags.
+		if label.GetValue() != "" {
+			writeTag(tagEscaper.Replace(label.GetName() + ":" + label.GetValue()))
+		}
+	}
+	return b.String()
+}
+
+// tagEscaper replaces the separators of the DogStatsD datagrams in the tags.
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+
+// Close closes the connection to the server.
+func (e *Emitter) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,119 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen returns a local datagram socket and a function reading the lines
+// received in a datagram.
+func listen(t *testing.T, network, address string) (net.PacketConn, func() []string) {
+	t.Helper()
+	conn, err := net.ListenPacket(network, address)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn, func() []string {
+		t.Helper()
+		buffer := make([]byte, maxUnixPayload)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := conn.ReadFrom(buffer)
+		require.NoError(t, err)
+		lines := strings.Split(string(buffer[:n]), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+}
+
+type testMetrics struct {
+	registry *prometheus.Registry
+	gauge    *prometheus.GaugeVec
+	counter  *prometheus.CounterVec
+}
+
+func newTestMetrics(t *testing.T) *testMetrics {
+	t.Helper()
+	m := &testMetrics{
+		registry: prometheus.NewRegistry(),
+		gauge:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pihole_reply"}, []string{"hostname", "type", "empty"}),
+		counter:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "pihole_exporter_auth_attempts_total"}, []string{"hostname"}),
+	}
+	m.registry.MustRegister(m.gauge, m.counter)
+	return m
+}
+
+func (m *testMetrics) gather(t *testing.T) []*dto.MetricFamily {
+	t.Helper()
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+	return families
+}
+
+// TestEmitter tests that gauges are sent as they are and counters as their increase, with the labels as tags
+func TestEmitter(t *testing.T) {
+	conn, read := listen(t, "udp", "127.0.0.1:0")
+	emitter, err := NewEmitter(Options{Address: "udp://" + conn.LocalAddr().String(), Prefix: "home.", Tags: []string{"env:lab"}})
+	require.NoError(t, err)
+	defer emitter.Close()
+
+	m := newTestMetrics(t)
+	m.gauge.WithLabelValues("pi1", "NXDOMAIN", "").Set(3)
+	m.counter.WithLabelValues("pi1").Add(2)
+	require.NoError(t, emitter.Push(context.Background(), m.gather(t), time.Now()))
+	assert.Equal(t, []string{"home.pihole_reply:3|g|#env:lab,hostname:pi1,type:NXDOMAIN"}, read(), "the first counter value is the base of the next increase")
+
+	m.counter.WithLabelValues("pi1").Add(5)
+	require.NoError(t, emitter.Push(context.Background(), m.gather(t), time.Now()))
+	assert.Equal(t, []string{
+		"home.pihole_exporter_auth_attempts_total:5|c|#env:lab,hostname:pi1",
+		"home.pihole_reply:3|g|#env:lab,hostname:pi1,type:NXDOMAIN",
+	}, read())
+}
+
+// TestEmitter_Sampling tests that the sampled metrics are sent at their rate
+func TestEmitter_Sampling(t *testing.T) {
+	conn, read := listen(t, "udp", "127.0.0.1:0")
+	emitter, err := NewEmitter(Options{Address: conn.LocalAddr().String(), SampleRates: map[string]float64{"pihole_reply": 0.25}})
+	require.NoError(t, err)
+	defer emitter.Close()
+
+	var rates []float64
+	emitter.sample = func(rate float64) bool {
+		rates = append(rates, rate)
+		return len(rates) > 1
+	}
+
+	m := newTestMetrics(t)
+	m.gauge.WithLabelValues("pi1", "IP", "").Set(1)
+	m.gauge.WithLabelValues("pi2", "IP", "").Set(2)
+	require.NoError(t, emitter.Push(context.Background(), m.gather(t), time.Now()))
+	assert.Equal(t, []string{"pihole_reply:2|g|@0.25|#hostname:pi2,type:IP"}, read())
+	assert.Equal(t, []float64{0.25, 0.25}, rates)
+}
+
+// TestEmitter_Unix tests that the metrics are sent to a Unix socket, split in datagrams of the maximum payload
+func TestEmitter_Unix(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dsd.socket")
+	_, read := listen(t, "unixgram", socket)
+	emitter, err := NewEmitter(Options{Address: "unix://" + socket})
+	require.NoError(t, err)
+	defer emitter.Close()
+	emitter.maxPayload = 60
+
+	m := newTestMetrics(t)
+	m.gauge.WithLabelValues("pi1", "IP", "").Set(1)
+	m.gauge.WithLabelValues("pi2", "IP", "").Set(2)
+	require.NoError(t, emitter.Push(context.Background(), m.gather(t), time.Now()))
+	assert.Equal(t, []string{"pihole_reply:1|g|#hostname:pi1,type:IP"}, read())
+	assert.Equal(t, []string{"pihole_reply:2|g|#hostname:pi2,type:IP"}, read())
+}
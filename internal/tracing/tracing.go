@@ -0,0 +1,52 @@
+// Package tracing sets up the OpenTelemetry tracing of the scrapes and of the
+// requests made to the Pi-hole API.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/common/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the name of the exporter in the traces.
+const ServiceName = "pihole-exporter"
+
+const instrumentationName = "github.com/eko/pihole-exporter"
+
+// Tracer returns the tracer of the exporter, which records nothing unless
+// Setup was called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup exports the spans to the OTLP/HTTP endpoint, an URL such as
+// http://collector:4318/v1/traces, and extracts the W3C trace context of the
+// scrape requests. The returned function flushes the pending spans and stops
+// the export.
+func Setup(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName), semconv.ServiceVersion(version.Version)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
@@ -1,15 +1,35 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/eko/pihole-exporter/config"
+	"github.com/eko/pihole-exporter/internal/fleet"
+	"github.com/eko/pihole-exporter/internal/influxdb"
 	"github.com/eko/pihole-exporter/internal/metrics"
+	"github.com/eko/pihole-exporter/internal/mqtt"
+	"github.com/eko/pihole-exporter/internal/otlp"
 	"github.com/eko/pihole-exporter/internal/pihole"
+	"github.com/eko/pihole-exporter/internal/push"
+	"github.com/eko/pihole-exporter/internal/pushgateway"
+	"github.com/eko/pihole-exporter/internal/remotewrite"
 	"github.com/eko/pihole-exporter/internal/server"
+	"github.com/eko/pihole-exporter/internal/statsd"
+	"github.com/eko/pihole-exporter/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/xonvanetta/shutdown/pkg/shutdown"
 )
 
@@ -19,37 +39,288 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load configuration: %v", err)
 	}
-	if envConf.Debug {
-		log.SetLevel(log.DebugLevel)
+	configureLogging(envConf)
+	envConf.Show()
+
+	log.Infof("starting pihole-exporter %s", version.Info())
+
+	if err := web.Validate(envConf.WebConfigFile); err != nil {
+		log.Fatalf("invalid web configuration file: %v", err)
+	}
+	if err := server.ValidateLifecycle(envConf); err != nil {
+		log.Fatalf("invalid lifecycle configuration: %v", err)
 	}
 
-	log.Infof("starting pihole-exporter")
+	metrics.Init(envConf.PercentagesAsRatios)
+	metrics.InitExporter()
+	if envConf.ReplyTimeHistograms {
+		metrics.InitReplyTime(envConf.ReplyTimeBuckets, envConf.ReplyTimeFactor)
+	}
 
-	metrics.Init()
+	if envConf.TracingEndpoint != "" {
+		shutdownTracing, err := tracing.Setup(context.Background(), envConf.TracingEndpoint)
+		if err != nil {
+			log.Fatalf("failed to set up tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), envConf.Timeout)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Warnf("Failed to flush traces: %v", err)
+			}
+		}()
+		log.Infof("exporting traces to %s", envConf.TracingEndpoint)
+	}
 
 	clients := buildClients(clientConfigs, envConf)
-	defer closeClients(clients)
 
-	srv := server.NewServer(envConf.BindAddr, envConf.Port, clients)
+	if envConf.Once {
+		registerFleet(envConf, func() []*pihole.Client { return clients })
+		err := runOnce(shutdown.Context(), clients, envConf)
+		closeClients(clients)
+		if err != nil {
+			log.Errorf("Failed to push the metrics of every target: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	srv := server.NewServer(envConf, clients)
+	srv.OnReload(func() error { return reload(srv, envConf) })
+	registerFleet(envConf, srv.Clients)
 
 	// Context that is cancelled on SIGINT/SIGTERM.
 	ctx := shutdown.Context()
 
+	reloadOnSignal(ctx, srv, envConf)
+	if envConf.ConfigFile != "" {
+		err := config.Watch(ctx, envConf.ConfigFile, func() {
+			if err := reload(srv, envConf); err != nil {
+				log.Errorf("Failed to reload configuration: %v", err)
+			}
+		})
+		if err != nil {
+			log.Fatalf("failed to watch configuration file: %v", err)
+		}
+	}
+
+	pushed := startPush(ctx, srv, envConf)
+
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-ctx.Done()
-		srv.Stop()
+		shutdownServer(srv, envConf.ShutdownGracePeriod)
 	}()
 
-	if err := srv.ListenAndServe(); err != nil {
+	if envConf.DisableListener {
+		log.Info("HTTP listener disabled, only pushing metrics")
+	} else if err := srv.ListenAndServe(); err != nil {
 		// Ignore the expected error when the server is closed gracefully.
 		if !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("HTTP server error: %v", err)
 		}
 	}
+	<-stopped
+
+	// No reload may replace the clients once they are closed.
+	reloadMu.Lock()
+	closeClients(srv.Clients())
+	<-pushed
 
 	log.Info("pihole-exporter HTTP server stopped")
 }
 
+// registerFleet registers the fleet aggregates of the targets, when enabled.
+// A target is aggregated while its last collection succeeded within the
+// readiness max age.
+func registerFleet(envConf *config.EnvConfig, targets func() []*pihole.Client) {
+	if envConf.FleetMetrics {
+		prometheus.MustRegister(fleet.NewCollector(targets, envConf.PercentagesAsRatios, envConf.ReadinessMaxAge))
+	}
+}
+
+// startPush pushes the metrics to the configured sinks every push interval,
+// until ctx is done. The returned channel is closed once the last push ended.
+func startPush(ctx context.Context, srv *server.Server, envConf *config.EnvConfig) <-chan struct{} {
+	done := make(chan struct{})
+
+	sinks := buildSinks(ctx, envConf, srv.Clients)
+	if len(sinks) == 0 {
+		close(done)
+		return done
+	}
+	log.Infof("pushing metrics every %s", envConf.PushInterval)
+	go func() {
+		defer close(done)
+		push.Run(ctx, envConf.PushInterval, envConf.ScrapeTimeout, srv.Collect, prometheus.DefaultGatherer, sinks...)
+	}()
+	return done
+}
+
+// runOnce collects the metrics of every target a single time and pushes them
+// to the configured sinks, for the hosts running the exporter as a cron job.
+// It returns an error when a target could not be collected or a push failed.
+func runOnce(ctx context.Context, clients []*pihole.Client, envConf *config.EnvConfig) error {
+	sinks := buildSinks(ctx, envConf, func() []*pihole.Client { return clients })
+	defer push.Close(sinks...)
+
+	var mu sync.Mutex
+	var errs []error
+	collect := func(ctx context.Context) {
+		var wg sync.WaitGroup
+		for _, c := range clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := c.CollectMetrics(ctx)
+				metrics.ScrapeSuccess.WithLabelValues(c.GetHostname()).Set(metrics.BoolToFloat(err == nil))
+				if err != nil {
+					log.WithField("hostname", c.GetHostname()).Errorf("An error occurred while collecting metrics: %v", err)
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("failed to collect metrics of %s: %w", c.GetHostname(), err))
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	if err := push.Once(ctx, envConf.ScrapeTimeout, collect, prometheus.DefaultGatherer, sinks...); err != nil {
+		errs = append(errs, fmt.Errorf("failed to push metrics: %w", err))
+	}
+
+	// The sinks sending in the background are given the timeout to send
+	// before exiting.
+	flushCtx, cancel := context.WithTimeout(ctx, envConf.Timeout)
+	defer cancel()
+	if err := push.Flush(flushCtx, sinks...); err != nil {
+		errs = append(errs, fmt.Errorf("failed to send metrics: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// buildSinks sets up the sinks the metrics are pushed to, targets returning
+// the current Pi-hole clients.
+func buildSinks(ctx context.Context, envConf *config.EnvConfig, targets func() []*pihole.Client) []push.Sink {
+	var sinks []push.Sink
+	if envConf.InfluxDBURL != "" {
+		writer, err := influxdb.NewWriter(influxdb.Options{
+			URL:         envConf.InfluxDBURL,
+			Org:         envConf.InfluxDBOrg,
+			Bucket:      envConf.InfluxDBBucket,
+			Token:       envConf.InfluxDBToken,
+			Measurement: envConf.InfluxDBMeasurement,
+			BatchSize:   int(envConf.InfluxDBBatchSize),
+			BufferPath:  envConf.InfluxDBBufferPath,
+			Timeout:     envConf.Timeout,
+		})
+		if err != nil {
+			log.Fatalf("failed to set up InfluxDB push: %v", err)
+		}
+		sinks = append(sinks, writer)
+		log.Infof("pushing metrics to InfluxDB %s", envConf.InfluxDBURL)
+	}
+	if envConf.OTLPMetricsEndpoint != "" {
+		exporter, err := otlp.NewExporter(ctx, envConf.OTLPMetricsEndpoint, envConf.OTLPMetricsProtocol, envConf.Timeout)
+		if err != nil {
+			log.Fatalf("failed to set up OTLP metrics export: %v", err)
+		}
+		sinks = append(sinks, exporter)
+		log.Infof("pushing metrics over OTLP to %s", envConf.OTLPMetricsEndpoint)
+	}
+	if envConf.RemoteWriteURL != "" {
+		sender, err := remotewrite.NewSender(remotewrite.Options{
+			URL:         envConf.RemoteWriteURL,
+			BearerToken: envConf.RemoteWriteToken,
+			Username:    envConf.RemoteWriteUsername,
+			Password:    envConf.RemoteWritePassword,
+			WALPath:     envConf.RemoteWriteWALPath,
+			Timeout:     envConf.Timeout,
+		})
+		if err != nil {
+			log.Fatalf("failed to set up remote write: %v", err)
+		}
+		sinks = append(sinks, sender)
+		log.Infof("sending metrics with remote write to %s", envConf.RemoteWriteURL)
+	}
+	if envConf.PushgatewayURL != "" {
+		sinks = append(sinks, pushgateway.NewPusher(envConf.PushgatewayURL, envConf.PushgatewayJob, envConf.Timeout))
+		log.Infof("pushing metrics to the Pushgateway %s", envConf.PushgatewayURL)
+	}
+	if envConf.MQTTURL != "" {
+		publisher, err := mqtt.NewPublisher(mqtt.Options{
+			URL:             envConf.MQTTURL,
+			Username:        envConf.MQTTUsername,
+			Password:        envConf.MQTTPassword,
+			ClientID:        envConf.MQTTClientID,
+			TopicPrefix:     envConf.MQTTTopicPrefix,
+			DiscoveryPrefix: envConf.MQTTDiscoveryPrefix,
+			CAFile:          envConf.MQTTCAFile,
+			CertFile:        envConf.MQTTCertFile,
+			KeyFile:         envConf.MQTTKeyFile,
+			Timeout:         envConf.Timeout,
+		}, targets)
+		if err != nil {
+			log.Fatalf("failed to set up MQTT publishing: %v", err)
+		}
+		sinks = append(sinks, publisher)
+		log.Infof("publishing metrics to the MQTT broker %s", envConf.MQTTURL)
+	}
+	if envConf.StatsDAddress != "" {
+		// The sample rates are checked when loading the configuration.
+		sampleRates, _ := envConf.StatsDSampleRateMap()
+		emitter, err := statsd.NewEmitter(statsd.Options{
+			Address:     envConf.StatsDAddress,
+			Prefix:      envConf.StatsDPrefix,
+			Tags:        envConf.StatsDTags,
+			SampleRates: sampleRates,
+		})
+		if err != nil {
+			log.Fatalf("failed to set up DogStatsD: %v", err)
+		}
+		sinks = append(sinks, emitter)
+		log.Infof("sending metrics to DogStatsD %s", envConf.StatsDAddress)
+	}
+	return sinks
+}
+
+// shutdownServer stops accepting scrapes and waits up to gracePeriod for the
+// ones in flight to end. The collections still running afterwards are
+// cancelled when the clients are closed.
+func shutdownServer(srv *server.Server, gracePeriod time.Duration) {
+	log.Infof("shutting down, waiting up to %s for in-flight scrapes", gracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warnf("Scrapes still in flight after the grace period are cancelled: %v", err)
+	}
+}
+
+// configureLogging applies the log format and level of the configuration,
+// debug being a shortcut for the debug level.
+func configureLogging(envConf *config.EnvConfig) {
+	switch envConf.LogFormat {
+	case config.LogFormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	case config.LogFormatLogfmt:
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true, DisableColors: true})
+	default:
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	}
+
+	level, err := log.ParseLevel(envConf.LogLevel)
+	if err != nil {
+		// The level is checked when loading the configuration.
+		level = log.InfoLevel
+	}
+	if envConf.Debug {
+		level = log.DebugLevel
+	}
+	log.SetLevel(level)
+}
+
 // buildClients constructs a slice of Pi‑hole API clients from configuration.
 func buildClients(clientConfigs []config.Config, envConfig *config.EnvConfig) []*pihole.Client {
 	clients := make([]*pihole.Client, 0, len(clientConfigs))
@@ -61,11 +332,78 @@ func buildClients(clientConfigs []config.Config, envConfig *config.EnvConfig) []
 	return clients
 }
 
-// closeClients closes each client, logging progress.
+// reloadMu serializes the reloads triggered by signals, configuration file
+// changes and the /-/reload endpoint.
+var reloadMu sync.Mutex
+
+// reload loads the configuration again and applies the changes of the Pi-hole
+// targets to the server: added targets get a new client, removed ones are
+// closed and their metrics deleted, and the kept ones are updated in place.
+// The current targets are kept when the new configuration is invalid.
+// Only the Pi-hole targets are reloaded, the listener settings require a restart
+// and the metric settings of the startup configuration must be kept.
+func reload(srv *server.Server, startup *config.EnvConfig) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	log.Info("reloading configuration")
+	envConf, clientConfigs, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := envConf.CheckReload(startup); err != nil {
+		return err
+	}
+
+	configureLogging(envConf)
+	envConf.Show()
+	clients, removed := pihole.Reconcile(srv.Clients(), clientConfigs, envConf)
+	srv.SetClients(clients)
+
+	for _, c := range removed {
+		c.Close()
+		if !slices.ContainsFunc(clients, func(client *pihole.Client) bool { return client.GetHostname() == c.GetHostname() }) {
+			metrics.DeleteHostname(c.GetHostname())
+		}
+	}
+
+	log.Infof("configuration reloaded, %d target(s)", len(clients))
+	return nil
+}
+
+// reloadOnSignal reloads the configuration each time SIGHUP is received, until
+// ctx is cancelled.
+func reloadOnSignal(ctx context.Context, srv *server.Server, startup *config.EnvConfig) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := reload(srv, startup); err != nil {
+					log.Errorf("Failed to reload configuration: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// closeClients closes each client concurrently, which cancels their requests
+// in flight and logs their sessions out, logging progress.
 func closeClients(clients []*pihole.Client) {
 	log.Info("closing clients…")
+	var wg sync.WaitGroup
 	for _, c := range clients {
-		c.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
 	}
+	wg.Wait()
 	log.Info("all clients closed")
 }